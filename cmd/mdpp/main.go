@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	flag "github.com/spf13/pflag"
 
@@ -25,41 +26,21 @@ const stdinFileName = "-"
 
 func showUsage(cmdln *flag.FlagSet) {
 	fmt.Fprintf(os.Stderr, "Usage: %s [options] [file...]\n", appID)
+	fmt.Fprintf(os.Stderr, "       %s pin [options] [file...]\n", appID)
+	fmt.Fprintf(os.Stderr, "       %s extract-tables [options] [file...]\n", appID)
 	cmdln.SetOutput(os.Stderr)
 	cmdln.PrintDefaults()
 }
 
-func mdppMain(args []string) (err error) {
-	cmdln := flag.NewFlagSet(appID, flag.ContinueOnError)
-
-	var shouldPrintHelp bool
-	cmdln.BoolVarP(&shouldPrintHelp, "help", "h", false, "Show help")
-
-	var inPlace bool
-	cmdln.BoolVarP(&inPlace, "in-place", "i", false, "Edit file(s) in-place")
-
-	var debugMode bool
-	cmdln.BoolVarP(&debugMode, "debug", "d", false, "Enable debug mode")
+// processFunc rewrites the Markdown source read from a file into the writer. inDirPath is the directory of the file.
+type processFunc func(sourceMD []byte, writer io.Writer, inDirPath string) error
 
-	var allowRemote bool
-	cmdln.BoolVarP(&allowRemote, "allow-remote", "r", false, "Allow fetching content from remote URLs in INCLUDE directives")
-
-	err = cmdln.Parse(args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		showUsage(cmdln)
-		return errors.New("")
+// processFiles applies fn to each of the files in inPaths and writes the results to standard output, or back to the files if inPlace is true.
+func processFiles(inPaths []string, inPlace bool, fn processFunc) (err error) {
+	if len(inPaths) == 0 {
+		inPaths = append(inPaths, stdinFileName)
 	}
-
-	if shouldPrintHelp {
-		showUsage(cmdln)
-		return nil
-	}
-	args = cmdln.Args()
-	if len(args) == 0 {
-		args = append(args, stdinFileName)
-	}
-	for _, inPath := range args {
+	for _, inPath := range inPaths {
 		err = func() error {
 			var inDirPath string
 			var inFile *os.File
@@ -101,7 +82,7 @@ func mdppMain(args []string) (err error) {
 				return fmt.Errorf("failed to read inFile: %s Error: %v", inPath, err)
 			}
 			bufOut := bufio.NewWriter(outFile)
-			err = mdpp.Process(sourceMD, bufOut, &inDirPath, mdpp.WithDebug(debugMode), mdpp.WithAllowRemote(allowRemote))
+			err = fn(sourceMD, bufOut, inDirPath)
 			if err != nil {
 				return fmt.Errorf("failed to preprocess: %v", err)
 			}
@@ -152,6 +133,129 @@ func mdppMain(args []string) (err error) {
 	return err
 }
 
+// extractTables writes the tables of each of the files in inPaths to files in outDirPath named after the file and the 1-based index of the table, e.g. "README-1.csv". The files are written only if their contents change.
+func extractTables(inPaths []string, format string, outDirPath string, opts mdpp.Options) (err error) {
+	if len(inPaths) == 0 {
+		inPaths = append(inPaths, stdinFileName)
+	}
+	for _, inPath := range inPaths {
+		var sourceMD []byte
+		inDirPath := "."
+		baseName := "table"
+		if inPath == stdinFileName {
+			sourceMD, err = io.ReadAll(os.Stdin)
+		} else {
+			inDirPath = filepath.Dir(inPath)
+			baseName = strings.TrimSuffix(filepath.Base(inPath), filepath.Ext(inPath))
+			sourceMD, err = os.ReadFile(inPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read inFile: %s Error: %v", inPath, err)
+		}
+		var tables [][][]string
+		tables, err = mdpp.ExtractTables(sourceMD, &inDirPath, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to extract tables: %s Error: %v", inPath, err)
+		}
+		for i, tableData := range tables {
+			var content []byte
+			content, err = mdpp.EncodeTable(tableData, format)
+			if err != nil {
+				return
+			}
+			outPath := filepath.Join(outDirPath, fmt.Sprintf("%s-%d.%s", baseName, i+1, strings.ToLower(format)))
+			if err = mdpp.WriteFileIfChanged(outPath, content); err != nil {
+				return fmt.Errorf("failed to write table: %s Error: %v", outPath, err)
+			}
+		}
+	}
+	return nil
+}
+
+func mdppMain(args []string) (err error) {
+	cmdln := flag.NewFlagSet(appID, flag.ContinueOnError)
+
+	// The first argument "pin" selects the subcommand that pins the digests of remote includes.
+	pinMode := len(args) > 0 && args[0] == "pin"
+	if pinMode {
+		args = args[1:]
+	}
+
+	// The first argument "extract-tables" selects the subcommand that writes the tables to files.
+	extractMode := len(args) > 0 && !pinMode && args[0] == "extract-tables"
+	if extractMode {
+		args = args[1:]
+	}
+
+	var shouldPrintHelp bool
+	cmdln.BoolVarP(&shouldPrintHelp, "help", "h", false, "Show help")
+
+	var inPlace bool
+	cmdln.BoolVarP(&inPlace, "in-place", "i", false, "Edit file(s) in-place")
+
+	var debugMode bool
+	cmdln.BoolVarP(&debugMode, "debug", "d", false, "Enable debug mode")
+
+	var allowRemote bool
+	cmdln.BoolVarP(&allowRemote, "allow-remote", "r", false, "Allow fetching content from remote URLs in INCLUDE directives")
+
+	var allowHosts []string
+	cmdln.StringSliceVar(&allowHosts, "allow-host", nil, "Allow remote URLs only for hostname patterns (e.g. \"*.example.com\") or URL prefixes; can be repeated")
+
+	var denyHosts []string
+	cmdln.StringSliceVar(&denyHosts, "deny-host", nil, "Deny remote URLs for hostname patterns or URL prefixes; can be repeated")
+
+	var configPath string
+	cmdln.StringVarP(&configPath, "config", "c", "", "Configuration file (default \""+mdpp.DefaultConfigFileName+"\" in the current directory if it exists)")
+
+	var tableFormat string
+	var outDirPath string
+	if extractMode {
+		cmdln.StringVarP(&tableFormat, "format", "f", "csv", "Format of the extracted tables: csv, tsv or json")
+		cmdln.StringVarP(&outDirPath, "output-dir", "o", ".", "Directory to write the extracted tables to")
+	}
+
+	err = cmdln.Parse(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		showUsage(cmdln)
+		return errors.New("")
+	}
+
+	if shouldPrintHelp {
+		showUsage(cmdln)
+		return nil
+	}
+	config := &mdpp.Config{}
+	if configPath != "" {
+		config, err = mdpp.LoadConfig(configPath)
+	} else if _, err2 := os.Stat(mdpp.DefaultConfigFileName); err2 == nil {
+		config, err = mdpp.LoadConfig(mdpp.DefaultConfigFileName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %v", err)
+	}
+	opts := mdpp.Options{
+		mdpp.WithConfig(config),
+		mdpp.WithDebug(debugMode),
+		mdpp.WithAllowRemote(allowRemote),
+		mdpp.WithAllowHosts(allowHosts),
+		mdpp.WithDenyHosts(denyHosts),
+		mdpp.WithDiagnosticOutput(os.Stderr),
+	}
+	if extractMode {
+		return extractTables(cmdln.Args(), tableFormat, outDirPath, opts)
+	}
+	if pinMode {
+		return processFiles(cmdln.Args(), inPlace, func(sourceMD []byte, writer io.Writer, _ string) error {
+			return mdpp.Pin(sourceMD, writer, opts...)
+		})
+	}
+	return processFiles(cmdln.Args(), inPlace, func(sourceMD []byte, writer io.Writer, inDirPath string) error {
+		return mdpp.Process(sourceMD, writer, &inDirPath, opts...)
+	})
+}
+
 func main() {
 	Debugger()
 	err := mdppMain(os.Args[1:])
@@ -13,6 +13,9 @@ func TestMain(t *testing.T) {
 	}{
 		{"help option", []string{"--help"}, false},
 		{"invalid option", []string{"--foo"}, true},
+		{"pin help option", []string{"pin", "--help"}, false},
+		{"extract-tables help option", []string{"extract-tables", "--help"}, false},
+		{"extract-tables option in the main command", []string{"--output-dir", "."}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	gmast "github.com/yuin/goldmark/ast"
 
@@ -29,34 +30,130 @@ func splitLines(content []byte) [][]byte {
 	return lines
 }
 
-// processFencedCodeBlock processes a fenced code block with a CODE directive, writes the result to writer, and returns the new writing position.
-func processFencedCodeBlock(
+// processCodeDirective processes a CODE directive, writes the result to writer, and returns the new writing position. The code block before the directive can be either fenced or indented.
+func processCodeDirective(
 	sourceMD []byte, // The source markdown content
 	writer io.Writer, // The output destination
 	writePos int, // The current write position in the source
 	directiveNode *gmast.HTMLBlock, // The HTML block node containing the CODE directive
 	codeFilePath string, // The path to the code file to include
+	argsText string, // The arguments following the path
+	params *processParams, // The processing parameters
 ) (
 	nextWritePos int, // The next write position after processing
 ) {
 	nextWritePos = writePos
-	prevNode := directiveNode.PreviousSibling()
-	if prevNode == nil || prevNode.Kind() != gmast.KindFencedCodeBlock {
+	args, err := parseDirectiveArgs(argsText)
+	if err != nil {
+		params.warnf("%v", err)
 		return
 	}
-	fencedCodeBlock, ok := prevNode.(*gmast.FencedCodeBlock)
-	if !ok {
+	opts, err := parseCodeOptions(args, &params.config.Code)
+	if err != nil {
+		params.warnf("CODE %s: %v", codeFilePath, err)
 		return
 	}
-	codeBlockLines := fencedCodeBlock.Lines()
+	filters, hide, err := parseLineFilters(args, params.config)
+	if err != nil {
+		params.warnf("CODE %s: %v", codeFilePath, err)
+		return
+	}
+	codeFileContent, err := os.ReadFile(codeFilePath)
+	if err != nil {
+		return
+	}
+	codeLines, highlighted := highlightLines(splitLines(codeFileContent), opts)
+	codeLines, fileIndexes, err := filterLines(codeLines, filters, hide)
+	if err != nil {
+		params.warnf("CODE %s: %v", codeFilePath, err)
+	}
+	codeLines, origins := transformCodeLines(codeLines, opts)
+	for i, origin := range origins {
+		if origin >= 0 {
+			origins[i] = fileIndexes[origin]
+		}
+	}
+	attributes := codeLineAttributes(origins, highlighted, opts)
+	language := opts.language
+	if opts.detectLanguage {
+		language = detectLanguage(codeFilePath, codeFileContent, params.config.Code.Languages)
+	}
+	prevNode := directiveNode.PreviousSibling()
+	if prevNode == nil || (prevNode.Kind() != gmast.KindFencedCodeBlock && prevNode.Kind() != gmast.KindCodeBlock) {
+		// No code block to update, so create one with an appropriate info string
+		if language == "" && !opts.disableLanguage {
+			language = detectLanguage(codeFilePath, codeFileContent, params.config.Code.Languages)
+		}
+		return insertFencedCodeBlocks(sourceMD, writer, writePos, directiveNode, fencedCodeBlockContent{lines: codeLines, language: language, attributes: attributes})
+	}
+	nextWritePos = processFencedCodeBlock(sourceMD, writer, writePos, directiveNode, fencedCodeBlockContent{lines: codeLines, language: language, attributes: attributes})
+	if nextWritePos == writePos {
+		// Fenced code block processing failed, try indented code block
+		nextWritePos = processIndentedCodeBlock(sourceMD, writer, writePos, directiveNode, codeLines)
+	}
+	return
+}
+
+// fencedCodeBlockContent is the content of a fenced code block to write.
+type fencedCodeBlockContent struct {
+	lines      [][]byte         // The lines of the code block
+	language   string           // The info string of a new code block, or the language to set in the info string of an existing one
+	attributes []fenceAttribute // The attributes to set in the info string
+}
+
+// insertFencedCodeBlocks writes new fenced code blocks before the directive, each followed by a blank line, and returns the new writing position. The blocks are placed in the same container as the directive.
+func insertFencedCodeBlocks(
+	sourceMD []byte, // The source markdown content
+	writer io.Writer, // The output destination
+	writePos int, // The current write position in the source
+	directiveNode *gmast.HTMLBlock, // The HTML block node containing the directive
+	blocks ...fencedCodeBlockContent, // The code blocks to write
+) (
+	nextWritePos int, // The next write position after processing
+) {
 	directiveLines := directiveNode.Lines()
 	directiveStartPos := directiveLines.At(0).Start
 	directiveEndPos := directiveLines.At(directiveLines.Len() - 1).Stop
-	linePrefix := ""
+	lineStartPos := findLineStart(sourceMD, directiveStartPos)
+	// The first line takes over the prefix of the directive line, which may contain a list marker
+	firstLinePrefix := string(sourceMD[lineStartPos:directiveStartPos])
+	linePrefix := continuationPrefix(firstLinePrefix)
+	Must(writer.Write(sourceMD[writePos:lineStartPos]))
+	for i, block := range blocks {
+		fence := strings.Repeat("`", requiredFenceLength(block.lines, '`'))
+		info := block.language
+		if len(block.attributes) > 0 {
+			info = setInfoAttributes(info, block.attributes)
+		}
+		Must(fmt.Fprintf(writer, "%s%s%s\n", Ternary(i == 0, firstLinePrefix, linePrefix), fence, info))
+		for _, line := range block.lines {
+			Must(fmt.Fprintf(writer, "%s%s\n", linePrefix, line))
+		}
+		Must(fmt.Fprintf(writer, "%s%s\n%s\n", linePrefix, fence, strings.TrimRight(linePrefix, " \t")))
+	}
+	Must(io.WriteString(writer, linePrefix))
+	Must(writer.Write(sourceMD[directiveStartPos:directiveEndPos]))
+	return directiveEndPos
+}
+
+// fencedCodeBlockLocation holds the positions of the parts of a fenced code block in the source.
+type fencedCodeBlockLocation struct {
+	openFenceStart  int    // The start of the fence run of the opening line
+	openFenceEnd    int    // The end of the fence run of the opening line
+	contentStart    int    // The start of the first content line, or the closing fence line if there is no content
+	contentEnd      int    // The start of the closing fence line
+	closeFenceStart int    // The start of the fence run of the closing line
+	closeFenceEnd   int    // The end of the fence run of the closing line
+	linePrefix      string // The container prefix of the lines
+}
+
+// locateFencedCodeBlock locates the parts of a fenced code block in the source. followingPos is the start of the node that follows the block, which is needed to find the fences of a block without content.
+func locateFencedCodeBlock(sourceMD []byte, fencedCodeBlock *gmast.FencedCodeBlock, followingPos int) (loc fencedCodeBlockLocation, ok bool) {
+	codeBlockLines := fencedCodeBlock.Lines()
 	var codeBlockStartPos int
 	var codeBlockEndPos int
 	if codeBlockLines.Len() == 0 {
-		codeBlockEndPos = directiveStartPos - 1
+		codeBlockEndPos = followingPos - 1
 	outer:
 		for ; codeBlockEndPos >= 0; codeBlockEndPos-- {
 			if bytes.HasPrefix(sourceMD[codeBlockEndPos:], []byte("```")) {
@@ -65,7 +162,7 @@ func processFencedCodeBlock(
 				}
 				for i := codeBlockEndPos; i >= 0; i-- {
 					if i == 0 || sourceMD[i-1] == '\n' {
-						linePrefix = string(sourceMD[i:codeBlockEndPos])
+						loc.linePrefix = string(sourceMD[i:codeBlockEndPos])
 						codeBlockEndPos = i
 						break outer
 					}
@@ -76,7 +173,7 @@ func processFencedCodeBlock(
 				}
 				for i := codeBlockEndPos; i >= 0; i-- {
 					if i == 0 || sourceMD[i-1] == '\n' {
-						linePrefix = string(sourceMD[i:codeBlockEndPos])
+						loc.linePrefix = string(sourceMD[i:codeBlockEndPos])
 						codeBlockEndPos = i
 						break outer
 					}
@@ -89,35 +186,132 @@ func processFencedCodeBlock(
 		codeBlockEndPos = codeBlockLines.At(codeBlockLines.Len() - 1).Stop
 		for i := codeBlockEndPos; i < len(sourceMD); i++ {
 			if sourceMD[i] == '`' {
-				linePrefix = string(sourceMD[codeBlockEndPos:i])
+				loc.linePrefix = string(sourceMD[codeBlockEndPos:i])
 				break
 			} else if sourceMD[i] == '~' {
-				linePrefix = string(sourceMD[codeBlockEndPos:i])
+				loc.linePrefix = string(sourceMD[codeBlockEndPos:i])
 				break
 			}
 		}
 	}
-	codeFileContent, err := os.ReadFile(codeFilePath)
-	if err != nil {
+	if codeBlockStartPos <= 0 {
 		return
 	}
-	Must(writer.Write(sourceMD[writePos:codeBlockStartPos]))
-	codeLines := splitLines(codeFileContent)
-	for _, line := range codeLines {
-		Must(fmt.Fprintf(writer, "%s%s\n", linePrefix, line))
+	loc.contentStart = codeBlockStartPos
+	loc.contentEnd = codeBlockEndPos
+	loc.openFenceStart, loc.openFenceEnd = findFenceRun(sourceMD, findLineStart(sourceMD, codeBlockStartPos-1))
+	loc.closeFenceStart, loc.closeFenceEnd = findFenceRun(sourceMD, codeBlockEndPos)
+	ok = loc.openFenceStart >= 0 && loc.closeFenceStart >= 0
+	return
+}
+
+// writeFencedCodeBlock writes the source from writePos up to the end of the closing fence of the located code block, replacing its content with the new one, and returns the position after the closing fence.
+func writeFencedCodeBlock(
+	sourceMD []byte, // The source markdown content
+	writer io.Writer, // The output destination
+	writePos int, // The current write position in the source
+	loc fencedCodeBlockLocation, // The location of the code block
+	content fencedCodeBlockContent, // The new content of the code block
+) (
+	nextWritePos int, // The position after the closing fence
+) {
+	// Lengthen the fences if the new content contains a line that would close the block
+	fenceChar := sourceMD[loc.openFenceStart]
+	fenceLength := max(loc.openFenceEnd-loc.openFenceStart, requiredFenceLength(content.lines, fenceChar))
+	Must(writer.Write(sourceMD[writePos:loc.openFenceStart]))
+	Must(writer.Write(bytes.Repeat([]byte{fenceChar}, fenceLength)))
+	infoStart := loc.openFenceEnd
+	if content.language != "" || len(content.attributes) > 0 {
+		infoEnd := infoStart + bytes.IndexByte(sourceMD[infoStart:loc.contentStart], '\n')
+		info := string(sourceMD[infoStart:infoEnd])
+		if content.language != "" {
+			info = setInfoLanguage(info, content.language)
+		}
+		if len(content.attributes) > 0 {
+			info = setInfoAttributes(info, content.attributes)
+		}
+		Must(io.WriteString(writer, info))
+		infoStart = infoEnd
 	}
-	Must(writer.Write(sourceMD[codeBlockEndPos:directiveEndPos]))
+	Must(writer.Write(sourceMD[infoStart:loc.contentStart]))
+	for _, line := range content.lines {
+		Must(fmt.Fprintf(writer, "%s%s\n", loc.linePrefix, line))
+	}
+	Must(writer.Write(sourceMD[loc.contentEnd:loc.closeFenceStart]))
+	Must(writer.Write(bytes.Repeat([]byte{fenceChar}, max(loc.closeFenceEnd-loc.closeFenceStart, fenceLength))))
+	return loc.closeFenceEnd
+}
+
+// processFencedCodeBlock processes a fenced code block with a CODE directive, writes the result to writer, and returns the new writing position.
+func processFencedCodeBlock(
+	sourceMD []byte, // The source markdown content
+	writer io.Writer, // The output destination
+	writePos int, // The current write position in the source
+	directiveNode *gmast.HTMLBlock, // The HTML block node containing the CODE directive
+	content fencedCodeBlockContent, // The new content of the code block
+) (
+	nextWritePos int, // The next write position after processing
+) {
+	nextWritePos = writePos
+	fencedCodeBlock, ok := directiveNode.PreviousSibling().(*gmast.FencedCodeBlock)
+	if !ok {
+		return
+	}
+	directiveLines := directiveNode.Lines()
+	directiveStartPos := directiveLines.At(0).Start
+	directiveEndPos := directiveLines.At(directiveLines.Len() - 1).Stop
+	loc, ok := locateFencedCodeBlock(sourceMD, fencedCodeBlock, directiveStartPos)
+	if !ok {
+		return
+	}
+	pos := writeFencedCodeBlock(sourceMD, writer, writePos, loc, content)
+	Must(writer.Write(sourceMD[pos:directiveEndPos]))
 	nextWritePos = directiveEndPos
 	return
 }
 
+// findFenceRun returns the range of the run of backticks or tildes that forms the fence in the line starting at lineStart. It returns -1 if the line has no fence.
+func findFenceRun(sourceMD []byte, lineStart int) (runStart int, runEnd int) {
+	runStart = -1
+	for i := lineStart; i < len(sourceMD) && sourceMD[i] != '\n'; i++ {
+		if sourceMD[i] == '`' || sourceMD[i] == '~' {
+			runStart = i
+			break
+		}
+	}
+	if runStart < 0 {
+		return -1, -1
+	}
+	runEnd = runStart
+	for runEnd < len(sourceMD) && sourceMD[runEnd] == sourceMD[runStart] {
+		runEnd++
+	}
+	return
+}
+
+// requiredFenceLength returns the minimum length of a fence made of fenceChar that none of the lines can close. Any line starting with three or more fenceChar is considered a possible closing fence.
+func requiredFenceLength(lines [][]byte, fenceChar byte) int {
+	length := 3
+	for _, line := range lines {
+		trimmedLine := bytes.TrimLeft(line, " \t")
+		n := 0
+		for n < len(trimmedLine) && trimmedLine[n] == fenceChar {
+			n++
+		}
+		if n >= length {
+			length = n + 1
+		}
+	}
+	return length
+}
+
 // processIndentedCodeBlock processes an indented code block with a CODE directive, writes the result to writer, and returns the new writing position.
 func processIndentedCodeBlock(
 	sourceMD []byte, // The source markdown content
 	writer io.Writer, // The output destination
 	writePos int, // The current write position in the source
 	directiveNode *gmast.HTMLBlock, // The HTML block node containing the CODE directive
-	codeFilePath string, // The path to the code file to include
+	codeLines [][]byte, // The lines to write into the code block
 ) (
 	nextWritePos int, // The next write position after processing
 ) {
@@ -150,12 +344,7 @@ func processIndentedCodeBlock(
 		}
 	}
 
-	codeFileContent, err := os.ReadFile(codeFilePath)
-	if err != nil {
-		return
-	}
 	Must(writer.Write(sourceMD[writePos:codeBlockStartPos]))
-	codeLines := splitLines(codeFileContent)
 	for _, line := range codeLines {
 		Must(fmt.Fprintf(writer, "%s%s\n", indentPrefix, line))
 	}
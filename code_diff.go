@@ -0,0 +1,80 @@
+package mdpp
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	gmast "github.com/yuin/goldmark/ast"
+)
+
+// defaultDiffContext is the number of context lines of a unified diff, which is the same as diff(1).
+const defaultDiffContext = 3
+
+// unifiedDiff returns the unified diff of the two files. The result is empty if the files are identical.
+func unifiedDiff(oldFilePath string, newFilePath string, context int) (string, error) {
+	oldContent, err := os.ReadFile(oldFilePath)
+	if err != nil {
+		return "", err
+	}
+	newContent, err := os.ReadFile(newFilePath)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(oldContent)),
+		B:        difflib.SplitLines(string(newContent)),
+		FromFile: oldFilePath,
+		ToFile:   newFilePath,
+		Context:  context,
+	})
+}
+
+// processCodeDiffDirective processes a CODEDIFF directive, which writes the unified diff of two files into the code block before the directive, and returns the new writing position. If there is no code block, a fenced code block with the info string `diff` is created.
+func processCodeDiffDirective(
+	sourceMD []byte, // The source markdown content
+	writer io.Writer, // The output destination
+	writePos int, // The current write position in the source
+	directiveNode *gmast.HTMLBlock, // The HTML block node containing the CODEDIFF directive
+	argsText string, // The arguments of the directive
+	params *processParams, // The processing parameters
+) (
+	nextWritePos int, // The next write position after processing
+) {
+	nextWritePos = writePos
+	args, err := parseDirectiveArgs(argsText)
+	if err != nil {
+		params.warnf("%v", err)
+		return
+	}
+	if len(args.positional) < 2 {
+		params.warnf("CODEDIFF requires two files: %s", argsText)
+		return
+	}
+	context, err := args.getInt("context", defaultDiffContext)
+	if err == nil && context < 0 {
+		err = fmt.Errorf("context must not be negative: %d", context)
+	}
+	if err != nil {
+		params.warnf("CODEDIFF: %v", err)
+		return
+	}
+	diffText, err := unifiedDiff(args.positional[0], args.positional[1], context)
+	if err != nil {
+		params.warnf("CODEDIFF: %v", err)
+		return
+	}
+	diffLines := splitLines([]byte(diffText))
+	prevNode := directiveNode.PreviousSibling()
+	if prevNode == nil || (prevNode.Kind() != gmast.KindFencedCodeBlock && prevNode.Kind() != gmast.KindCodeBlock) {
+		return insertFencedCodeBlocks(sourceMD, writer, writePos, directiveNode, fencedCodeBlockContent{lines: diffLines, language: "diff"})
+	}
+	// The info string of an existing code block is kept
+	nextWritePos = processFencedCodeBlock(sourceMD, writer, writePos, directiveNode, fencedCodeBlockContent{lines: diffLines})
+	if nextWritePos == writePos {
+		nextWritePos = processIndentedCodeBlock(sourceMD, writer, writePos, directiveNode, diffLines)
+	}
+	return
+}
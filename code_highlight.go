@@ -0,0 +1,130 @@
+package mdpp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// regexpHighlightMarker matches the highlight marker at the end of a line of code, which is a comment consisting of "hl", e.g. "// hl", "# hl" or "/* hl */".
+var regexpHighlightMarker = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`[ \t]*(?://|#|--|;|/\*|<!--)[ \t]*hl[ \t]*(?:\*/|-->)?[ \t]*$`)
+})
+
+// regexpInfoAttribute matches an item in the attribute block of an info string, which is either `key=value` or a bare word such as `.class`.
+var regexpInfoAttribute = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_-]*)[ \t]*=[ \t]*(?:"[^"]*"|'[^']*'|\[[^\]]*\]|[^ \t,}]+)|[^ \t,}]+`)
+})
+
+// highlightLines reports for each line whether it is highlighted by a marker or by the pattern. Markers are removed from the lines.
+func highlightLines(lines [][]byte, opts codeOptions) (result [][]byte, highlighted []bool) {
+	result = make([][]byte, len(lines))
+	highlighted = make([]bool, len(lines))
+	for i, line := range lines {
+		result[i] = line
+		if opts.highlightMarkers {
+			if loc := regexpHighlightMarker().FindIndex(line); loc != nil {
+				result[i] = line[:loc[0]]
+				highlighted[i] = true
+			}
+		}
+		if opts.highlightPattern != nil && opts.highlightPattern.Match(line) {
+			highlighted[i] = true
+		}
+	}
+	return
+}
+
+// formatLineRanges formats the ascending line numbers as space-separated ranges, e.g. "3-5 8".
+func formatLineRanges(lineNumbers []int) string {
+	var ranges []string
+	for i := 0; i < len(lineNumbers); {
+		j := i
+		for j+1 < len(lineNumbers) && lineNumbers[j+1] == lineNumbers[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(lineNumbers[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lineNumbers[i], lineNumbers[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, " ")
+}
+
+// codeLineAttributes returns the fence attributes for the highlighted lines and the line number of the first line. origins holds the index in the original file of each embedded line, or -1 for a line that is not in the file.
+func codeLineAttributes(origins []int, highlighted []bool, opts codeOptions) (attributes []fenceAttribute) {
+	if opts.highlightMarkers || opts.highlightPattern != nil {
+		var lineNumbers []int
+		for i, origin := range origins {
+			if origin >= 0 && highlighted[origin] {
+				lineNumbers = append(lineNumbers, i+1)
+			}
+		}
+		value := ""
+		if len(lineNumbers) > 0 {
+			value = strconv.Quote(formatLineRanges(lineNumbers))
+		}
+		attributes = append(attributes, fenceAttribute{key: "hl_lines", value: value})
+	}
+	if opts.lineNumberStart && len(origins) > 0 && origins[0] >= 0 {
+		attributes = append(attributes, fenceAttribute{key: "linenostart", value: strconv.Itoa(origins[0] + 1)})
+	}
+	return
+}
+
+// fenceAttribute is an attribute in the attribute block of the info string of a fenced code block, e.g. `hl_lines="3-5"` in "go {hl_lines="3-5"}".
+type fenceAttribute struct {
+	key   string
+	value string // The value of the attribute, or empty to remove the attribute
+}
+
+// setInfoAttributes sets the attributes in the attribute block at the end of the info string, adding the block if there is none. The other attributes are kept, and the block is removed if it becomes empty.
+func setInfoAttributes(info string, attributes []fenceAttribute) string {
+	head := strings.TrimRight(info, " \t")
+	inner := ""
+	if strings.HasSuffix(head, "}") {
+		if i := strings.LastIndex(head, "{"); i >= 0 {
+			inner = head[i+1 : len(head)-1]
+			head = strings.TrimRight(head[:i], " \t")
+		}
+	}
+	separator := " "
+	if strings.Contains(inner, ",") {
+		separator = ","
+	}
+	items := regexpInfoAttribute().FindAllStringSubmatch(inner, -1)
+	var result []string
+	done := make([]bool, len(attributes))
+	for _, item := range items {
+		j := -1
+		for k, attribute := range attributes {
+			if item[1] == attribute.key {
+				j = k
+			}
+		}
+		switch {
+		case j < 0:
+			result = append(result, item[0])
+		case attributes[j].value != "" && !done[j]:
+			result = append(result, attributes[j].key+"="+attributes[j].value)
+			done[j] = true
+		}
+	}
+	for k, attribute := range attributes {
+		if !done[k] && attribute.value != "" {
+			result = append(result, attribute.key+"="+attribute.value)
+		}
+	}
+	if len(result) == 0 {
+		return head
+	}
+	block := "{" + strings.Join(result, separator) + "}"
+	if head == "" {
+		return block
+	}
+	return head + " " + block
+}
@@ -0,0 +1,156 @@
+package mdpp
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// elisionMarker is the line that replaces the lines cut off by the maxlines option of the CODE directive.
+const elisionMarker = "…"
+
+// codeOptions holds the options of the CODE directive that transform the lines of the embedded file.
+type codeOptions struct {
+	tabWidth int  // Expand tabs to this many spaces if positive (`tabs=N`)
+	trim     bool // Trim leading and trailing blank lines (`trim`)
+	dedent   bool // Strip the common leading indentation (`dedent`)
+	maxLines int  // Cap the number of lines with an elision marker if positive (`maxlines=N`)
+
+	language        string // Set the info string of a fenced code block to this language (`lang=NAME`)
+	detectLanguage  bool   // Set the info string of a fenced code block from the type of the file (`lang`)
+	disableLanguage bool   // Never set the info string (`lang=none`)
+
+	highlightMarkers bool           // Highlight the lines with a marker comment such as "// hl" (`hl`)
+	highlightPattern *regexp.Regexp // Highlight the lines matching the pattern (`hl=REGEX`)
+	lineNumberStart  bool           // Set the line number of the first line in the file (`linenostart`)
+}
+
+// parseCodeOptions parses the options of the CODE directive. The configuration provides the default of the lang option.
+func parseCodeOptions(args *directiveArgs, config *CodeConfig) (opts codeOptions, err error) {
+	switch language, _ := args.get("lang"); {
+	case args.flag("lang"):
+		opts.detectLanguage = true
+	case language == "none" || language == "false":
+		opts.disableLanguage = true
+	case language != "":
+		opts.language = language
+	default:
+		opts.detectLanguage = config.Lang
+	}
+	if pattern, _ := args.get("hl"); args.flag("hl") {
+		opts.highlightMarkers = true
+	} else if pattern != "" {
+		if opts.highlightPattern, err = regexp.Compile(pattern); err != nil {
+			return
+		}
+	}
+	opts.lineNumberStart = args.flag("linenostart")
+	opts.trim = args.flag("trim")
+	opts.dedent = args.flag("dedent")
+	if opts.tabWidth, err = args.getInt("tabs", 0); err != nil {
+		return
+	}
+	if opts.maxLines, err = args.getInt("maxlines", 0); err != nil {
+		return
+	}
+	if opts.tabWidth < 0 || opts.maxLines < 0 {
+		err = fmt.Errorf("tabs and maxlines must not be negative")
+	}
+	return
+}
+
+// isBlankLine reports whether the line consists only of whitespace.
+func isBlankLine(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
+
+// expandTabs replaces tabs in the line with spaces up to the next tab stop.
+func expandTabs(line []byte, tabWidth int) []byte {
+	if !bytes.ContainsRune(line, '\t') {
+		return line
+	}
+	var expanded []byte
+	column := 0
+	for _, r := range string(line) {
+		if r == '\t' {
+			spaces := tabWidth - column%tabWidth
+			expanded = append(expanded, bytes.Repeat([]byte{' '}, spaces)...)
+			column += spaces
+			continue
+		}
+		expanded = append(expanded, string(r)...)
+		column++
+	}
+	return expanded
+}
+
+// trimBlankLines removes the leading and trailing blank lines, and returns the number of the removed leading lines.
+func trimBlankLines(lines [][]byte) ([][]byte, int) {
+	leading := 0
+	for len(lines) > 0 && isBlankLine(lines[0]) {
+		lines = lines[1:]
+		leading++
+	}
+	for len(lines) > 0 && isBlankLine(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, leading
+}
+
+// dedentLines strips the leading whitespace that is common to all non-blank lines. Blank lines become empty.
+func dedentLines(lines [][]byte) [][]byte {
+	var common []byte
+	first := true
+	for _, line := range lines {
+		if isBlankLine(line) {
+			continue
+		}
+		indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+		if first {
+			common = indent
+			first = false
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(indent) && common[n] == indent[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	result := make([][]byte, len(lines))
+	for i, line := range lines {
+		if isBlankLine(line) {
+			result[i] = []byte{}
+		} else {
+			result[i] = line[len(common):]
+		}
+	}
+	return result
+}
+
+// transformCodeLines applies the options to the lines of the embedded file. origins holds the index of each resulting line in the file, or -1 for the elision marker.
+func transformCodeLines(lines [][]byte, opts codeOptions) (result [][]byte, origins []int) {
+	if opts.tabWidth > 0 {
+		expanded := make([][]byte, len(lines))
+		for i, line := range lines {
+			expanded[i] = expandTabs(line, opts.tabWidth)
+		}
+		lines = expanded
+	}
+	first := 0
+	if opts.trim {
+		lines, first = trimBlankLines(lines)
+	}
+	if opts.dedent {
+		lines = dedentLines(lines)
+	}
+	origins = make([]int, len(lines))
+	for i := range origins {
+		origins[i] = first + i
+	}
+	if opts.maxLines > 0 && len(lines) > opts.maxLines {
+		lines = append(lines[:opts.maxLines-1:opts.maxLines-1], []byte(elisionMarker))
+		origins = append(origins[:opts.maxLines-1], -1)
+	}
+	return lines, origins
+}
@@ -0,0 +1,55 @@
+package mdpp
+
+import (
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFileName is the name of the configuration file that the command loads from the current directory if no configuration file is specified.
+const DefaultConfigFileName = ".mdpp.yaml"
+
+// Config holds the settings loaded from a configuration file.
+type Config struct {
+	Code  CodeConfig  `yaml:"code"`
+	Table TableConfig `yaml:"table"`
+	// Filters maps filter names to the rules that the filter option of the CODE and INCLUDE directives applies.
+	Filters map[string][]FilterRule `yaml:"filters"`
+}
+
+// CodeConfig holds the settings of the CODE directive.
+type CodeConfig struct {
+	// Lang sets the info string of fenced code blocks from the type of the embedded file unless a directive specifies otherwise.
+	Lang bool `yaml:"lang"`
+	// Languages maps file names (e.g. "Jenkinsfile") or extensions (e.g. ".tmpl") to info strings, overriding the built-in mapping.
+	Languages map[string]string `yaml:"languages"`
+}
+
+// TableConfig holds the settings of the directives that write tables.
+type TableConfig struct {
+	// Compact writes the cells of tables without padding the columns to equal widths.
+	Compact bool `yaml:"compact"`
+}
+
+// FilterRule is a rule of a named filter. Exactly one of the fields is set.
+type FilterRule struct {
+	// Replace is a replace expression such as `/internal\.example\.com/example.com/`.
+	Replace string `yaml:"replace"`
+	// Drop is the pattern of the lines to drop.
+	Drop string `yaml:"drop"`
+	// Hide enables the hide and show markers, which hide the lines between them.
+	Hide bool `yaml:"hide"`
+}
+
+// LoadConfig loads the configuration from a YAML file.
+func LoadConfig(filePath string) (config *Config, err error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+	config = &Config{}
+	if err = yaml.Unmarshal(content, config); err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,128 @@
+package mdpp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// directiveOption is a `key=value` argument of a directive.
+type directiveOption struct {
+	key   string
+	value string
+}
+
+// directiveArgs holds the arguments that follow the directive name, e.g. `path/to/file key=value flag`.
+type directiveArgs struct {
+	positional []string
+	options    []directiveOption
+}
+
+// regexpOptionKey matches a token that can be an option key.
+var regexpOptionKey = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:-]*$`)
+})
+
+// splitDirectiveArgs splits the argument text of a directive into tokens separated by whitespace. Single and double quotes group characters into one token, and a backslash escapes the next character inside double quotes.
+func splitDirectiveArgs(text string) (tokens []string, err error) {
+	var token strings.Builder
+	inToken := false
+	var quote rune
+	escaped := false
+	for _, r := range text {
+		switch {
+		case escaped:
+			token.WriteRune(r)
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			token.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			token.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in directive arguments: %s", text)
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return
+}
+
+// parseDirectiveArgs parses the argument text of a directive into positional arguments and options.
+func parseDirectiveArgs(text string) (args *directiveArgs, err error) {
+	tokens, err := splitDirectiveArgs(text)
+	if err != nil {
+		return
+	}
+	args = &directiveArgs{}
+	for _, token := range tokens {
+		key, value, found := strings.Cut(token, "=")
+		if found && regexpOptionKey().MatchString(key) {
+			args.options = append(args.options, directiveOption{key: key, value: value})
+		} else {
+			args.positional = append(args.positional, token)
+		}
+	}
+	return
+}
+
+// get returns the value of the last option with the given key. Keys are case-insensitive.
+func (args *directiveArgs) get(key string) (value string, ok bool) {
+	for _, option := range args.options {
+		if strings.EqualFold(option.key, key) {
+			value, ok = option.value, true
+		}
+	}
+	return
+}
+
+// all returns the values of all options with the given key in order. Keys are case-insensitive.
+func (args *directiveArgs) all(key string) (values []string) {
+	for _, option := range args.options {
+		if strings.EqualFold(option.key, key) {
+			values = append(values, option.value)
+		}
+	}
+	return
+}
+
+// flag reports whether the boolean option with the given name is set, either as a bare word such as `dedent` or as `dedent=true`.
+func (args *directiveArgs) flag(name string) bool {
+	for _, word := range args.positional {
+		if strings.EqualFold(word, name) {
+			return true
+		}
+	}
+	value, ok := args.get(name)
+	return ok && strings.EqualFold(value, "true")
+}
+
+// getInt returns the value of the option with the given key as an integer, or defaultValue if the option is not set.
+func (args *directiveArgs) getInt(key string, defaultValue int) (int, error) {
+	value, ok := args.get(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %s", key, value)
+	}
+	return n, nil
+}
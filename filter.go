@@ -0,0 +1,166 @@
+package mdpp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Markers that hide the lines between them from the embedded content when the hide option is given. The marker lines are hidden as well.
+const (
+	hideMarker = "mdpp:hide"
+	showMarker = "mdpp:show"
+)
+
+// regexpFilterMarker matches a line that consists only of a comment holding a hide or show marker, e.g.:
+//
+//	// mdpp:hide
+//	# mdpp:show
+//	<!-- mdpp:hide -->
+var regexpFilterMarker = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^\s*(?://|#|--|;|/\*|<!--)\s*mdpp:(hide|show)\s*(?:\*/|-->)?\s*$`)
+})
+
+// filterMarkerIndex is the index of the marker name in the matches of the filter marker regex.
+const filterMarkerIndex = 1
+
+// lineFilter is a step of the filter pipeline applied to the lines of embedded content.
+type lineFilter struct {
+	pattern     *regexp.Regexp
+	replacement []byte // The replacement for the matches of the pattern, if the lines are not dropped
+	drop        bool   // Drop the lines matching the pattern
+}
+
+// splitDelimited splits an expression such as `/pattern/replacement/flags` into its parts. The first character is the delimiter, which can be escaped with a backslash.
+func splitDelimited(expr string) (parts []string, err error) {
+	if expr == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	delimiter := expr[0]
+	var part strings.Builder
+	for i := 1; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && i+1 < len(expr) && expr[i+1] == delimiter:
+			part.WriteByte(delimiter)
+			i++
+		case expr[i] == delimiter:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(expr[i])
+		}
+	}
+	return append(parts, part.String()), nil
+}
+
+// parseReplaceFilter parses a replace expression `/pattern/replacement/` with an optional `i` flag for case-insensitive matching. The replacement can refer to submatches as `$1` or `${name}`.
+func parseReplaceFilter(expr string) (filter lineFilter, err error) {
+	parts, err := splitDelimited(expr)
+	if err != nil {
+		return
+	}
+	if len(parts) != 3 || parts[0] == "" || (parts[2] != "" && parts[2] != "i") {
+		return filter, fmt.Errorf("invalid replace expression: %s", expr)
+	}
+	pattern := parts[0]
+	if parts[2] == "i" {
+		pattern = "(?i)" + pattern
+	}
+	if filter.pattern, err = regexp.Compile(pattern); err != nil {
+		return
+	}
+	filter.replacement = []byte(parts[1])
+	return
+}
+
+// parseDropFilter parses the pattern of the lines to drop. An empty pattern would drop every line and is an error.
+func parseDropFilter(pattern string) (filter lineFilter, err error) {
+	if pattern == "" {
+		return filter, fmt.Errorf("drop requires a pattern")
+	}
+	filter.pattern, err = regexp.Compile(pattern)
+	filter.drop = true
+	return
+}
+
+// parseLineFilters parses the replace, drop and filter options of a directive in order. A filter option refers to a named filter in the configuration. hide reports whether the hide option or a hide rule of a named filter enables the hide and show markers.
+func parseLineFilters(args *directiveArgs, config *Config) (filters []lineFilter, hide bool, err error) {
+	hide = args.flag("hide")
+	for _, option := range args.options {
+		var filter lineFilter
+		switch strings.ToLower(option.key) {
+		case "replace":
+			filter, err = parseReplaceFilter(option.value)
+		case "drop":
+			filter, err = parseDropFilter(option.value)
+		case "filter":
+			rules, ok := config.Filters[option.value]
+			if !ok {
+				return nil, false, fmt.Errorf("undefined filter: %s", option.value)
+			}
+			for _, rule := range rules {
+				switch {
+				case rule.Hide && rule.Replace == "" && rule.Drop == "":
+					hide = true
+					continue
+				case rule.Replace != "" && rule.Drop == "" && !rule.Hide:
+					filter, err = parseReplaceFilter(rule.Replace)
+				case rule.Drop != "" && rule.Replace == "" && !rule.Hide:
+					filter, err = parseDropFilter(rule.Drop)
+				default:
+					err = fmt.Errorf("a rule requires exactly one of replace, drop or hide")
+				}
+				if err != nil {
+					return nil, false, fmt.Errorf("filter %s: %w", option.value, err)
+				}
+				filters = append(filters, filter)
+			}
+			continue
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		filters = append(filters, filter)
+	}
+	return
+}
+
+// isFilterOption reports whether the option key is one of the filter options, which are not INCLUDE parameters.
+func isFilterOption(key string) bool {
+	return strings.EqualFold(key, "replace") || strings.EqualFold(key, "drop") || strings.EqualFold(key, "hide") || strings.EqualFold(key, "filter")
+}
+
+// filterLines hides the lines between the hide and show markers if hide is true, and then applies the filters in order. origins holds the index of each resulting line in the input. A hide marker without a following show marker hides the rest of the lines and is reported as an error along with the result.
+func filterLines(lines [][]byte, filters []lineFilter, hide bool) (result [][]byte, origins []int, err error) {
+	hidden := false
+outer:
+	for i, line := range lines {
+		if hide {
+			if matches := regexpFilterMarker().FindSubmatch(line); matches != nil {
+				hidden = string(matches[filterMarkerIndex]) == "hide"
+				continue
+			}
+			if hidden {
+				continue
+			}
+		}
+		for _, filter := range filters {
+			if filter.drop {
+				if filter.pattern.Match(line) {
+					continue outer
+				}
+				continue
+			}
+			line = filter.pattern.ReplaceAll(line, filter.replacement)
+		}
+		result = append(result, line)
+		origins = append(origins, i)
+	}
+	if hidden {
+		err = fmt.Errorf("%s without %s hides the rest of the content", hideMarker, showMarker)
+	}
+	return
+}
@@ -0,0 +1,206 @@
+package mdpp
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strings"
+
+	gmast "github.com/yuin/goldmark/ast"
+)
+
+// goAPIHeader is the header row of the API table.
+var goAPIHeader = []string{"Name", "Signature", "Description"}
+
+// loadGoPackageDoc parses the non-test Go files of the package directory that match the build constraints and returns the documentation of the package.
+func loadGoPackageDoc(dirPath string) (*doc.Package, *token.FileSet, error) {
+	buildPkg, err := build.ImportDir(dirPath, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, fileName := range buildPkg.GoFiles {
+		file, err := parser.ParseFile(fset, filepath.Join(dirPath, fileName), nil, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, file)
+	}
+	docPkg, err := doc.NewFromFiles(fset, files, buildPkg.ImportPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return docPkg, fset, nil
+}
+
+// formatGoSignature prints the node in a single line.
+func formatGoSignature(fset *token.FileSet, node any) string {
+	var buf bytes.Buffer
+	if err := (&printer.Config{Mode: printer.RawFormat}).Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	signature := strings.Join(strings.Fields(buf.String()), " ")
+	// Remove the spaces and the trailing comma left by parameters that span lines
+	return strings.NewReplacer("( ", "(", ", )", ")").Replace(signature)
+}
+
+// goFuncSignature returns the signature of the function or the method without its body.
+func goFuncSignature(fset *token.FileSet, decl *ast.FuncDecl) string {
+	sigDecl := *decl
+	sigDecl.Doc = nil
+	sigDecl.Body = nil
+	return formatGoSignature(fset, &sigDecl)
+}
+
+// goTypeSignature returns the declaration of the type, in which the fields of a struct and the methods of an interface are elided as `go doc -short` does.
+func goTypeSignature(fset *token.FileSet, spec *ast.TypeSpec) string {
+	sigSpec := *spec
+	sigSpec.Doc = nil
+	sigSpec.Comment = nil
+	switch spec.Type.(type) {
+	case *ast.StructType:
+		sigSpec.Type = ast.NewIdent("struct{ ... }")
+	case *ast.InterfaceType:
+		sigSpec.Type = ast.NewIdent("interface{ ... }")
+	}
+	return "type " + formatGoSignature(fset, &sigSpec)
+}
+
+// goValueRows returns the rows of the exported constants or variables declared in the value group. The bodies of function literals in the values are elided as `{ ... }`.
+func goValueRows(fset *token.FileSet, docPkg *doc.Package, value *doc.Value) (rows [][]string) {
+	keyword := value.Decl.Tok.String()
+	for _, spec := range value.Decl.Specs {
+		valueSpec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		// The comment of a spec takes precedence over the comment of the group
+		docText := value.Doc
+		if valueSpec.Doc != nil {
+			docText = valueSpec.Doc.Text()
+		}
+		sigSpec := *valueSpec
+		sigSpec.Doc = nil
+		sigSpec.Comment = nil
+		// The syntax trees are parsed only for the table, so the bodies of function literals are elided in place
+		for _, expr := range sigSpec.Values {
+			ast.Inspect(expr, func(node ast.Node) bool {
+				if funcLit, ok := node.(*ast.FuncLit); ok {
+					funcLit.Body = &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: ast.NewIdent("...")}}}
+					return false
+				}
+				return true
+			})
+		}
+		signature := keyword + " " + formatGoSignature(fset, &sigSpec)
+		for _, name := range valueSpec.Names {
+			if !name.IsExported() {
+				continue
+			}
+			rows = append(rows, []string{name.Name, signature, docPkg.Synopsis(docText)})
+		}
+	}
+	return
+}
+
+// goFuncRow returns the row of the function or the method. Methods are named after their receiver types, e.g. `Config.Load`.
+func goFuncRow(fset *token.FileSet, docPkg *doc.Package, fn *doc.Func) []string {
+	name := fn.Name
+	if fn.Recv != "" {
+		name = strings.TrimPrefix(fn.Recv, "*") + "." + name
+		if i := strings.Index(name, "["); i >= 0 {
+			// Drop the type parameters of a generic receiver, e.g. "List[T].Len"
+			name = name[:i] + name[strings.Index(name, "]")+1:]
+		}
+	}
+	return []string{name, goFuncSignature(fset, fn.Decl), docPkg.Synopsis(fn.Doc)}
+}
+
+// goAPITable returns the exported API of the package in the order of `go doc -all`: constants, variables, functions, and types followed by their constants, variables, constructors and methods.
+func goAPITable(dirPath string) ([][]string, error) {
+	docPkg, fset, err := loadGoPackageDoc(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	tableData := [][]string{goAPIHeader}
+	for _, value := range docPkg.Consts {
+		tableData = append(tableData, goValueRows(fset, docPkg, value)...)
+	}
+	for _, value := range docPkg.Vars {
+		tableData = append(tableData, goValueRows(fset, docPkg, value)...)
+	}
+	for _, fn := range docPkg.Funcs {
+		tableData = append(tableData, goFuncRow(fset, docPkg, fn))
+	}
+	for _, docType := range docPkg.Types {
+		var typeSpec *ast.TypeSpec
+		for _, spec := range docType.Decl.Specs {
+			if spec, ok := spec.(*ast.TypeSpec); ok && spec.Name.Name == docType.Name {
+				typeSpec = spec
+			}
+		}
+		if typeSpec == nil {
+			continue
+		}
+		tableData = append(tableData, []string{docType.Name, goTypeSignature(fset, typeSpec), docPkg.Synopsis(docType.Doc)})
+		for _, value := range docType.Consts {
+			tableData = append(tableData, goValueRows(fset, docPkg, value)...)
+		}
+		for _, value := range docType.Vars {
+			tableData = append(tableData, goValueRows(fset, docPkg, value)...)
+		}
+		for _, fn := range docType.Funcs {
+			tableData = append(tableData, goFuncRow(fset, docPkg, fn))
+		}
+		for _, fn := range docType.Methods {
+			tableData = append(tableData, goFuncRow(fset, docPkg, fn))
+		}
+	}
+	// Format the cells for a Markdown table
+	for _, rowData := range tableData[1:] {
+		rowData[0] = formatCodeSpan(rowData[0])
+		rowData[1] = formatCodeSpan(rowData[1])
+	}
+	return tableData, nil
+}
+
+// processGoAPIDirective processes a GOAPI directive, which replaces the table before the directive with the exported API of a Go package, writes the result to writer, and returns the new writing position.
+func processGoAPIDirective(
+	sourceMD []byte, // The source markdown content
+	writer io.Writer, // The output destination
+	writePos int, // The current write position in the source
+	directiveNode *gmast.HTMLBlock, // The HTML block node containing the GOAPI directive
+	argsText string, // The arguments of the directive
+	params *processParams, // The processing parameters
+) (
+	nextWritePos int, // The next write position after processing
+) {
+	args, err := parseDirectiveArgs(argsText)
+	if err != nil {
+		params.warnf("%v", err)
+		return writePos
+	}
+	if len(args.positional) == 0 {
+		params.warnf("GOAPI requires a package directory: %s", argsText)
+		return writePos
+	}
+	if findDirectiveTable(sourceMD, directiveNode) == nil {
+		params.warnf("GOAPI %s: no table before the directive", args.positional[0])
+		return writePos
+	}
+	return processTable(sourceMD, writer, writePos, directiveNode, func(content *tableContent) {
+		apiTableData, err := goAPITable(args.positional[0])
+		if err != nil {
+			params.warnf("GOAPI %s: %v", args.positional[0], err)
+			return
+		}
+		content.rows = apiTableData
+	}, params)
+}
@@ -0,0 +1,187 @@
+package mdpp
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	gmast "github.com/yuin/goldmark/ast"
+
+	//revive:disable-next-line:dot-imports
+	. "github.com/knaka/go-utils"
+)
+
+// regexpExampleOutput matches the text of the comment that holds the expected output of an example function, as go/doc does.
+var regexpExampleOutput = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?i)^[[:space:]]*(unordered )?output:`)
+})
+
+// exampleOutputComment returns the comment group that holds the expected output of the example function, which is the last comment in the body, or nil if there is none.
+func exampleOutputComment(body *ast.BlockStmt, comments []*ast.CommentGroup) (outputComment *ast.CommentGroup) {
+	for _, group := range comments {
+		if body.Lbrace < group.Pos() && group.End() < body.Rbrace {
+			outputComment = group
+		}
+	}
+	if outputComment == nil || !regexpExampleOutput().MatchString(outputComment.Text()) {
+		return nil
+	}
+	return
+}
+
+// goExample holds the code and the expected output of a Go example function.
+type goExample struct {
+	code      string
+	output    string
+	hasOutput bool
+}
+
+// findGoExample finds the example function with the given name, with or without the "Example" prefix, in the test files of the package directory.
+func findGoExample(dirPath string, name string) (example *goExample, err error) {
+	filePaths, err := filepath.Glob(filepath.Join(dirPath, "*_test.go"))
+	if err != nil {
+		return
+	}
+	sort.Strings(filePaths)
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, filePath := range filePaths {
+		var file *ast.File
+		file, err = parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+		if err != nil {
+			return
+		}
+		files = append(files, file)
+	}
+	name = strings.TrimPrefix(name, "Example")
+	for _, docExample := range doc.Examples(files...) {
+		if docExample.Name != name {
+			continue
+		}
+		var code string
+		code, err = formatGoExampleCode(fset, docExample)
+		if err != nil {
+			return
+		}
+		return &goExample{
+			code:      code,
+			output:    docExample.Output,
+			hasOutput: docExample.Output != "" || docExample.EmptyOutput,
+		}, nil
+	}
+	return nil, fmt.Errorf("example Example%s not found in %s", name, dirPath)
+}
+
+// formatGoExampleCode formats the code of the example as `go doc` presents it: the body of the function without the output comment, or a runnable program for a whole-file example.
+func formatGoExampleCode(fset *token.FileSet, docExample *doc.Example) (string, error) {
+	var buf bytes.Buffer
+	if file, ok := docExample.Code.(*ast.File); ok {
+		node := file
+		if docExample.Play != nil {
+			node = docExample.Play
+		}
+		if err := format.Node(&buf, fset, node); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+	comments := docExample.Comments
+	if body, ok := docExample.Code.(*ast.BlockStmt); ok {
+		if outputComment := exampleOutputComment(body, comments); outputComment != nil {
+			comments = slices.DeleteFunc(slices.Clone(comments), func(group *ast.CommentGroup) bool { return group == outputComment })
+		}
+	}
+	config := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := config.Fprint(&buf, fset, &printer.CommentedNode{Node: docExample.Code, Comments: comments}); err != nil {
+		return "", err
+	}
+	code := buf.String()
+	if n := len(code); n >= 2 && code[0] == '{' && code[n-1] == '}' {
+		// Remove the surrounding braces and unindent the body
+		lines := strings.Split(code[1:n-1], "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimPrefix(line, "\t")
+		}
+		code = strings.Join(lines, "\n")
+	}
+	return strings.TrimSpace(code), nil
+}
+
+// processGoExampleDirective processes a GOEXAMPLE directive, writes the result to writer, and returns the new writing position. The fenced code block before the directive receives the code of the example. With the `output` option, the last two fenced code blocks before the directive receive the code and the expected output respectively. Missing code blocks are created.
+func processGoExampleDirective(
+	sourceMD []byte, // The source markdown content
+	writer io.Writer, // The output destination
+	writePos int, // The current write position in the source
+	directiveNode *gmast.HTMLBlock, // The HTML block node containing the GOEXAMPLE directive
+	argsText string, // The arguments of the directive
+	params *processParams, // The processing parameters
+) (
+	nextWritePos int, // The next write position after processing
+) {
+	nextWritePos = writePos
+	args, err := parseDirectiveArgs(argsText)
+	if err != nil {
+		params.warnf("%v", err)
+		return
+	}
+	if len(args.positional) < 2 {
+		params.warnf("GOEXAMPLE requires a package directory and an example name: %s", argsText)
+		return
+	}
+	example, err := findGoExample(args.positional[0], args.positional[1])
+	if err != nil {
+		params.warnf("GOEXAMPLE: %v", err)
+		return
+	}
+	// The languages are set only in new code blocks, and the info strings of existing ones are kept
+	codeContent := fencedCodeBlockContent{lines: splitLines([]byte(example.code)), language: "go"}
+	existingCodeContent := fencedCodeBlockContent{lines: codeContent.lines}
+	directiveLines := directiveNode.Lines()
+	directiveStartPos := directiveLines.At(0).Start
+	directiveEndPos := directiveLines.At(directiveLines.Len() - 1).Stop
+	if !args.flag("output") {
+		if _, ok := directiveNode.PreviousSibling().(*gmast.FencedCodeBlock); !ok {
+			return insertFencedCodeBlocks(sourceMD, writer, writePos, directiveNode, codeContent)
+		}
+		return processFencedCodeBlock(sourceMD, writer, writePos, directiveNode, existingCodeContent)
+	}
+	if !example.hasOutput {
+		params.warnf("GOEXAMPLE: Example%s has no output comment", strings.TrimPrefix(args.positional[1], "Example"))
+	}
+	outputContent := fencedCodeBlockContent{lines: splitLines([]byte(example.output)), language: "text"}
+	existingOutputContent := fencedCodeBlockContent{lines: outputContent.lines}
+	outputBlock, ok := directiveNode.PreviousSibling().(*gmast.FencedCodeBlock)
+	if !ok {
+		return insertFencedCodeBlocks(sourceMD, writer, writePos, directiveNode, codeContent, outputContent)
+	}
+	outputLoc, ok := locateFencedCodeBlock(sourceMD, outputBlock, directiveStartPos)
+	if !ok {
+		return
+	}
+	codeBlock, ok := outputBlock.PreviousSibling().(*gmast.FencedCodeBlock)
+	if !ok {
+		// Only one code block exists, which receives the code, and the output block is created after it
+		pos := writeFencedCodeBlock(sourceMD, writer, writePos, outputLoc, existingCodeContent)
+		return insertFencedCodeBlocks(sourceMD, writer, pos, directiveNode, outputContent)
+	}
+	codeLoc, ok := locateFencedCodeBlock(sourceMD, codeBlock, findLineStart(sourceMD, outputLoc.openFenceStart))
+	if !ok {
+		return
+	}
+	pos := writeFencedCodeBlock(sourceMD, writer, writePos, codeLoc, existingCodeContent)
+	pos = writeFencedCodeBlock(sourceMD, writer, pos, outputLoc, existingOutputContent)
+	Must(writer.Write(sourceMD[pos:directiveEndPos]))
+	return directiveEndPos
+}
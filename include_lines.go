@@ -0,0 +1,88 @@
+package mdpp
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	gmast "github.com/yuin/goldmark/ast"
+
+	//revive:disable-next-line:dot-imports
+	. "github.com/knaka/go-utils"
+)
+
+// regexpContainerPrefix matches the container prefix of a line, which consists of indentation, blockquote markers and list markers, e.g. "  > " or "> - ".
+var regexpContainerPrefix = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^(?:[ \t]*(?:>[ \t]?|[-*+][ \t]+|\d{1,9}[.)][ \t]+))*[ \t]*`)
+})
+
+// regexpListMarker matches a list marker in a container prefix.
+var regexpListMarker = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`[-*+]|\d{1,9}[.)]`)
+})
+
+// splitContainerPrefix splits a line into its container prefix and the rest.
+func splitContainerPrefix(line string) (prefix string, body string) {
+	prefix = regexpContainerPrefix().FindString(line)
+	return prefix, line[len(prefix):]
+}
+
+// continuationPrefix returns the prefix for the lines that continue the container of a line with the given prefix. List markers are replaced with spaces so that the continuation lines stay inside the list item.
+func continuationPrefix(prefix string) string {
+	return regexpListMarker().ReplaceAllStringFunc(prefix, func(marker string) string {
+		return strings.Repeat(" ", len(marker))
+	})
+}
+
+// prefixLines prepends the prefix to every line of the content. Trailing whitespace of the prefix is not added to empty lines.
+func prefixLines(content string, prefix string) string {
+	if prefix == "" {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = strings.TrimRight(prefix, " \t")
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// directiveText returns the line without its container prefix and surrounding whitespace, to be matched against the directive regexes.
+func directiveText(line string) string {
+	_, body := splitContainerPrefix(line)
+	return strings.TrimSpace(body)
+}
+
+// markCodeLines reports for each line of the source whether it is content of a fenced or indented code block, according to the Markdown syntax tree. Directives on such lines are literal text.
+func markCodeLines(sourceMD []byte, lines []string) []bool {
+	inCode := make([]bool, len(lines))
+	lineStarts := make([]int, len(lines))
+	pos := 0
+	for i, line := range lines {
+		lineStarts[i] = pos
+		pos += len(line) + 1
+	}
+	gmTree, _ := gmParse(sourceMD)
+	Must(gmast.Walk(gmTree, func(node gmast.Node, entering bool) (gmast.WalkStatus, error) {
+		if !entering {
+			return gmast.WalkContinue, nil
+		}
+		if node.Kind() != gmast.KindCodeBlock && node.Kind() != gmast.KindFencedCodeBlock {
+			return gmast.WalkContinue, nil
+		}
+		segments := node.Lines()
+		for i := range segments.Len() {
+			// The line containing the segment start is the last one that starts at or before it
+			lineIndex := sort.SearchInts(lineStarts, segments.At(i).Start+1) - 1
+			if lineIndex >= 0 {
+				inCode[lineIndex] = true
+			}
+		}
+		return gmast.WalkSkipChildren, nil
+	}))
+	return inCode
+}
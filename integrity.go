@@ -0,0 +1,88 @@
+package mdpp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/knaka/go-utils/funcopt"
+)
+
+// integrityOptionKey is the option of the INCLUDE directive that holds the expected SHA-256 digest of the content.
+const integrityOptionKey = "sha256"
+
+// ErrIntegrityMismatch is returned when included content does not match its pinned SHA-256 digest.
+var ErrIntegrityMismatch = errors.New("integrity mismatch")
+
+// regexpIntegrityOption matches the sha256 option in the arguments of an INCLUDE directive. The digest is hexadecimal, so a closing "-->" right after it is not a part of it.
+var regexpIntegrityOption = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(\s)sha256=[0-9A-Fa-f]*`)
+})
+
+// sha256Hex returns the hex-encoded SHA-256 digest of the content.
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyIntegrity checks that the SHA-256 digest of the content matches the expected hex-encoded digest.
+func verifyIntegrity(content []byte, expected string) error {
+	actual := sha256Hex(content)
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: expected sha256=%s, got sha256=%s", ErrIntegrityMismatch, expected, actual)
+	}
+	return nil
+}
+
+// pinIncludeLine returns the INCLUDE directive line with its sha256 option set to the given digest.
+func pinIncludeLine(line string, digest string) string {
+	if loc := regexpIntegrityOption().FindStringSubmatchIndex(line); loc != nil {
+		return line[:loc[3]] + integrityOptionKey + "=" + digest + line[loc[1]:]
+	}
+	closeIndex := strings.LastIndex(line, "-->")
+	return strings.TrimRight(line[:closeIndex], " \t") + " " + integrityOptionKey + "=" + digest + " " + line[closeIndex:]
+}
+
+// Pin fetches the content of every remote +INCLUDE directive in the source markdown, fills in or refreshes its sha256 option with the digest of the content, and writes the result to the writer. Directives in the included content are left untouched. URLs are subject to WithAllowHosts and WithDenyHosts.
+func Pin(
+	sourceMD []byte,
+	writer io.Writer,
+	opts ...funcopt.Option[processParams],
+) (err error) {
+	params := processParams{}
+	if err = funcopt.Apply(&params, opts); err != nil {
+		return
+	}
+	lines := strings.Split(string(sourceMD), "\n")
+	inCode := markCodeLines(sourceMD, lines)
+	for i := 0; i < len(lines); i++ {
+		if inCode[i] {
+			continue
+		}
+		matches := regexpIncludeDirective().FindStringSubmatch(directiveText(lines[i]))
+		if len(matches) == 0 {
+			continue
+		}
+		endIndex := findIncludeEnd(lines, inCode, i)
+		if endIndex == -1 {
+			continue
+		}
+		if isURL(matches[includePathIndex]) {
+			var content []byte
+			content, err = fetchURL(matches[includePathIndex], "", &params.remotePolicy)
+			if err != nil {
+				return
+			}
+			lines[i] = pinIncludeLine(lines[i], sha256Hex(content))
+		}
+		// Skip the included content
+		i = endIndex
+	}
+	_, err = io.WriteString(writer, strings.Join(lines, "\n"))
+	return
+}
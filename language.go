@@ -0,0 +1,133 @@
+package mdpp
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// languagesByFileName maps file names to info strings.
+var languagesByFileName = map[string]string{
+	"Dockerfile":     "dockerfile",
+	"Containerfile":  "dockerfile",
+	"Makefile":       "makefile",
+	"GNUmakefile":    "makefile",
+	"Jenkinsfile":    "groovy",
+	"CMakeLists.txt": "cmake",
+}
+
+// languagesByExtension maps file extensions to info strings.
+var languagesByExtension = map[string]string{
+	".awk":   "awk",
+	".bash":  "bash",
+	".bat":   "batch",
+	".c":     "c",
+	".cc":    "cpp",
+	".cmd":   "batch",
+	".cpp":   "cpp",
+	".cs":    "csharp",
+	".css":   "css",
+	".csv":   "csv",
+	".diff":  "diff",
+	".go":    "go",
+	".h":     "c",
+	".hpp":   "cpp",
+	".html":  "html",
+	".ini":   "ini",
+	".java":  "java",
+	".js":    "javascript",
+	".json":  "json",
+	".jsx":   "jsx",
+	".kt":    "kotlin",
+	".lua":   "lua",
+	".md":    "markdown",
+	".mjs":   "javascript",
+	".patch": "diff",
+	".php":   "php",
+	".pl":    "perl",
+	".proto": "protobuf",
+	".ps1":   "powershell",
+	".py":    "python",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".scala": "scala",
+	".sh":    "sh",
+	".sql":   "sql",
+	".swift": "swift",
+	".tf":    "hcl",
+	".toml":  "toml",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".xml":   "xml",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".zsh":   "zsh",
+}
+
+// languagesByInterpreter maps the interpreters of shebang lines to info strings.
+var languagesByInterpreter = map[string]string{
+	"awk":     "awk",
+	"bash":    "bash",
+	"dash":    "sh",
+	"node":    "javascript",
+	"perl":    "perl",
+	"python":  "python",
+	"python3": "python",
+	"ruby":    "ruby",
+	"sh":      "sh",
+	"zsh":     "zsh",
+}
+
+// shebangInterpreter returns the name of the interpreter in the shebang line of the content, e.g. "bash" for "#!/usr/bin/env bash".
+func shebangInterpreter(content []byte) string {
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return ""
+	}
+	firstLine, _, _ := bytes.Cut(content[2:], []byte{'\n'})
+	fields := strings.Fields(string(firstLine))
+	for len(fields) > 0 {
+		name := filepath.Base(fields[0])
+		fields = fields[1:]
+		if name == "env" || strings.HasPrefix(name, "-") {
+			continue
+		}
+		return name
+	}
+	return ""
+}
+
+// detectLanguage returns the info string for a code block that embeds the file, determined from the overrides, the file name, the extension, and the shebang line in this order. It returns an empty string if the type is unknown.
+func detectLanguage(filePath string, content []byte, overrides map[string]string) string {
+	baseName := filepath.Base(filePath)
+	ext := strings.ToLower(filepath.Ext(baseName))
+	if language, ok := overrides[baseName]; ok {
+		return language
+	}
+	if language, ok := overrides[ext]; ok && ext != "" {
+		return language
+	}
+	if language, ok := languagesByFileName[baseName]; ok {
+		return language
+	}
+	if language, ok := languagesByExtension[ext]; ok {
+		return language
+	}
+	return languagesByInterpreter[shebangInterpreter(content)]
+}
+
+// setInfoLanguage returns the info string of a fenced code block with its language, the first word, replaced with the given one. Attributes following the language, or an info string consisting only of attributes such as `{hl_lines="3"}`, are preserved.
+func setInfoLanguage(info string, language string) string {
+	trimmedInfo := strings.TrimLeft(info, " \t")
+	leading := info[:len(info)-len(trimmedInfo)]
+	if trimmedInfo == "" {
+		return language
+	}
+	if strings.HasPrefix(trimmedInfo, "{") {
+		return leading + language + " " + trimmedInfo
+	}
+	wordEnd := strings.IndexAny(trimmedInfo, " \t{")
+	if wordEnd < 0 {
+		return leading + language
+	}
+	return leading + language + trimmedInfo[wordEnd:]
+}
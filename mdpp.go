@@ -2,6 +2,8 @@
 package mdpp
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"maps"
@@ -19,6 +21,7 @@ import (
 	gmmeta "github.com/yuin/goldmark-meta"
 	gmast "github.com/yuin/goldmark/ast"
 	gmext "github.com/yuin/goldmark/extension"
+	gmextast "github.com/yuin/goldmark/extension/ast"
 	gmparser "github.com/yuin/goldmark/parser"
 	gmtext "github.com/yuin/goldmark/text"
 	"golang.org/x/term"
@@ -55,12 +58,16 @@ var regexpMillerDirective = sync.OnceValue(func() *regexp.Regexp {
 	//
 	// or
 	//
+	//   <!-- +MLR: sort -nr Total then head -n 3 -->
+	//
+	// or
+	//
 	//   <!-- +MLR:
 	//     $Total = $UnitPrice * $Count
 	//   -->
 	//
 	// In the second case, the "closure" part is stored in the `.Closure` member of the node.
-	return regexp.MustCompile(`(?i)^<!--\s*\+(MLR|MILLER):\s*([^-]+?)\s*(-->\s*)?$`)
+	return regexp.MustCompile(`(?is)^<!--\s*\+(MLR|MILLER):\s*(.+?)\s*(-->\s*)?$`)
 })
 
 // millerScriptIndex is the index of the Miller script in the matches of the Miller directive regex.
@@ -92,22 +99,107 @@ var regexpTableIncludeDirective = sync.OnceValue(func() *regexp.Regexp {
 	//
 	//   <!-- +TABLE_INCLUDE: data.csv -->
 	//   <!-- +TINCLUDE: data.tsv -->
+	//   <!-- +TABLE_INCLUDE: data.csv columns=Name,Price rename=Price:Cost align=left,right -->
 	//
 	return regexp.MustCompile(`(?i)^<!--\s*\+(TABLE_INCLUDE|TINCLUDE):\s*(.+?)\s*-->\s*$`)
 })
 
-// tableIncludeFilePathIndex is the index of the file path in the matches of the TABLE_INCLUDE directive regex.
-const tableIncludeFilePathIndex = 2
+// tableIncludeArgsIndex is the index of the arguments in the matches of the TABLE_INCLUDE directive regex.
+const tableIncludeArgsIndex = 2
 
 var regexpCodeDirective = sync.OnceValue(func() *regexp.Regexp {
 	// Matches the code directive in HTML comments, e.g.:
 	//
 	//   <!-- +CODE: ./path/to/file -->
-	return regexp.MustCompile(`(?i)^<!--\s*\+CODE:\s*([^ ]+?)\s*-->\s*$`)
+	//   <!-- +CODE: ./path/to/file dedent tabs=4 -->
+	return regexp.MustCompile(`(?i)^<!--\s*\+CODE:\s*(\S+?)(?:\s+(.*?))?\s*-->\s*$`)
 })
 
 const codeSrcIndex = 1
 
+// codeArgsIndex is the index of the optional arguments in the matches of the CODE directive regex.
+const codeArgsIndex = 2
+
+// regexpCodeDiffDirective returns a compiled regex that matches CODEDIFF directives in HTML comments.
+var regexpCodeDiffDirective = sync.OnceValue(func() *regexp.Regexp {
+	// Matches the CODEDIFF directive in HTML comments, e.g.:
+	//
+	//   <!-- +CODEDIFF: old.go new.go -->
+	//   <!-- +CODEDIFF: old.go new.go context=1 -->
+	return regexp.MustCompile(`(?i)^<!--\s*\+CODEDIFF:\s*(.+?)\s*-->\s*$`)
+})
+
+// codeDiffArgsIndex is the index of the arguments in the matches of the CODEDIFF directive regex.
+const codeDiffArgsIndex = 1
+
+// regexpGoExampleDirective returns a compiled regex that matches GOEXAMPLE directives in HTML comments.
+var regexpGoExampleDirective = sync.OnceValue(func() *regexp.Regexp {
+	// Matches the GOEXAMPLE directive in HTML comments, e.g.:
+	//
+	//   <!-- +GOEXAMPLE: ./pkg ExampleFoo -->
+	//   <!-- +GOEXAMPLE: ./pkg ExampleFoo output -->
+	return regexp.MustCompile(`(?i)^<!--\s*\+GOEXAMPLE:\s*(.+?)\s*-->\s*$`)
+})
+
+// goExampleArgsIndex is the index of the arguments in the matches of the GOEXAMPLE directive regex.
+const goExampleArgsIndex = 1
+
+// regexpGoAPIDirective returns a compiled regex that matches GOAPI directives in HTML comments.
+var regexpGoAPIDirective = sync.OnceValue(func() *regexp.Regexp {
+	// Matches the GOAPI directive in HTML comments, e.g.:
+	//
+	//   <!-- +GOAPI: . -->
+	//   <!-- +GOAPI: ./cmd/mdpp -->
+	return regexp.MustCompile(`(?i)^<!--\s*\+GOAPI:\s*(.+?)\s*-->\s*$`)
+})
+
+// goAPIArgsIndex is the index of the arguments in the matches of the GOAPI directive regex.
+const goAPIArgsIndex = 1
+
+// regexpTableExportDirective returns a compiled regex that matches TABLE_EXPORT directives in HTML comments.
+var regexpTableExportDirective = sync.OnceValue(func() *regexp.Regexp {
+	// Matches the TABLE_EXPORT directive in HTML comments, e.g.:
+	//
+	//   <!-- +TABLE_EXPORT: data.csv -->
+	//   <!-- +TABLE_EXPORT: data.txt format=tsv -->
+	return regexp.MustCompile(`(?i)^<!--\s*\+TABLE_EXPORT:\s*(.+?)\s*-->\s*$`)
+})
+
+// tableExportArgsIndex is the index of the arguments in the matches of the TABLE_EXPORT directive regex.
+const tableExportArgsIndex = 1
+
+// regexpSQLDirective returns a compiled regex that matches SQL directives in HTML comments. The query can span multiple lines.
+var regexpSQLDirective = sync.OnceValue(func() *regexp.Regexp {
+	// Matches the SQL directive in HTML comments, e.g.:
+	//
+	//   <!-- +SQL: results.db SELECT name, score FROM results ORDER BY score DESC -->
+	//
+	// or
+	//
+	//   <!-- +SQL: table:sales=sales.csv
+	//     SELECT region, sum(amount) AS total
+	//     FROM sales GROUP BY region
+	//   -->
+	//
+	// In the second case, the "closure" part is stored in the `.Closure` member of the node.
+	return regexp.MustCompile(`(?is)^<!--\s*\+SQL:\s*(.+?)\s*(-->\s*)?$`)
+})
+
+// sqlArgsIndex is the index of the arguments in the matches of the SQL directive regex.
+const sqlArgsIndex = 1
+
+// regexpValueDirective returns a compiled regex that matches VALUE directives in HTML comments.
+var regexpValueDirective = sync.OnceValue(func() *regexp.Regexp {
+	// Matches the VALUE directive in HTML comments, e.g.:
+	//
+	//   <!-- +VALUE: chart/Chart.yaml .version -->
+	//   <!-- +VALUE: package.json .dependencies["react"] -->
+	return regexp.MustCompile(`(?i)^<!--\s*\+VALUE:\s*(.+?)\s*-->\s*$`)
+})
+
+// valueArgsIndex is the index of the arguments in the matches of the VALUE directive regex.
+const valueArgsIndex = 1
+
 var regexpSyncTitleDirective = sync.OnceValue(func() *regexp.Regexp {
 	return regexp.MustCompile(`(?i)^<!--\s*\+(SYNC_TITLE|TITLE)\s*(-->\s*)?$`)
 })
@@ -116,11 +208,15 @@ var regexpIncludeDirective = sync.OnceValue(func() *regexp.Regexp {
 	// Matches the INCLUDE directive in HTML comments, e.g.:
 	//
 	//   <!-- +INCLUDE: ./path/to/file.md -->
-	return regexp.MustCompile(`(?i)^<!--\s*\+INCLUDE:\s*([^ ]+?)\s*-->\s*$`)
+	//   <!-- +INCLUDE: https://example.com/file.md sha256=0123abcd... -->
+	return regexp.MustCompile(`(?i)^<!--\s*\+INCLUDE:\s*(\S+?)(?:\s+(.*?))?\s*-->\s*$`)
 })
 
 const includePathIndex = 1
 
+// includeArgsIndex is the index of the optional arguments in the matches of the INCLUDE directive regex.
+const includeArgsIndex = 2
+
 var regexpEndDirective = sync.OnceValue(func() *regexp.Regexp {
 	return regexp.MustCompile(`(?i)^<!--\s*\+END\s*-->\s*$`)
 })
@@ -142,31 +238,85 @@ func isURL(path string) bool {
 	return u.Scheme == "http" || u.Scheme == "https"
 }
 
-// fetchURL fetches content from a URL
-func fetchURL(urlStr string) ([]byte, error) {
-	resp, err := http.Get(urlStr)
+// fetchURL fetches content from a URL allowed by the policy. If integrity is not empty, the content is verified against it.
+func fetchURL(urlStr string, integrity string, policy *remotePolicy) ([]byte, error) {
+	if err := policy.check(urlStr); err != nil {
+		return nil, err
+	}
+	resp, err := policy.httpClient().Get(urlStr)
 	if err != nil {
 		return nil, err
 	}
 	defer (func() { _ = resp.Body.Close() })()
-	return io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", urlStr, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if integrity != "" {
+		if err = verifyIntegrity(content, integrity); err != nil {
+			return nil, fmt.Errorf("%s: %w", urlStr, err)
+		}
+	}
+	return content, nil
+}
+
+// findIncludeEnd returns the index of the +END directive line that closes the +INCLUDE directive at lines[includeIndex], or -1 if there is none. Lines marked in inCode are ignored.
+func findIncludeEnd(lines []string, inCode []bool, includeIndex int) int {
+	depth := 1
+	for j := includeIndex + 1; j < len(lines); j++ {
+		if inCode[j] {
+			continue
+		}
+		if regexpIncludeDirective().MatchString(directiveText(lines[j])) {
+			depth++
+		} else if regexpEndDirective().MatchString(directiveText(lines[j])) {
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// includeParameters returns the options of an INCLUDE directive that are substituted for the placeholders in the included content, i.e. all options except the reserved ones.
+func includeParameters(args *directiveArgs) map[string]string {
+	includeParams := make(map[string]string)
+	for _, option := range args.options {
+		if strings.EqualFold(option.key, integrityOptionKey) || isFilterOption(option.key) {
+			continue
+		}
+		includeParams[option.key] = option.value
+	}
+	return includeParams
 }
 
 // processIncludeDirectives processes +INCLUDE ... +END directives and returns the modified source
-func processIncludeDirectives(sourceMD []byte, allowRemote bool) []byte {
-	return processIncludeDirectivesWithLoopDetection(sourceMD, make(map[string]bool), allowRemote)
+func processIncludeDirectives(sourceMD []byte, params *processParams) ([]byte, error) {
+	return processIncludeDirectivesWithLoopDetection(sourceMD, make(map[string]bool), params)
 }
 
-// processIncludeDirectivesWithLoopDetection processes +INCLUDE ... +END directives with cycle detection
-func processIncludeDirectivesWithLoopDetection(sourceMD []byte, visited map[string]bool, allowRemote bool) []byte {
+// processIncludeDirectivesWithLoopDetection processes +INCLUDE ... +END directives with cycle detection.
+// Directives may be placed inside blockquotes and list items, in which case the included lines are prefixed to stay inside the container. Directives in fenced code blocks are ignored.
+// Content that fails the integrity check is not included and the error is returned after the whole source is processed.
+func processIncludeDirectivesWithLoopDetection(sourceMD []byte, visited map[string]bool, params *processParams) ([]byte, error) {
 	lines := strings.Split(string(sourceMD), "\n")
+	inCode := markCodeLines(sourceMD, lines)
 	var result []string
+	var errs []error
 	includeDepth := 0 // Track nesting depth to avoid processing nested directives
 	for i := 0; i < len(lines); i++ {
 		line := lines[i]
+		if inCode[i] {
+			result = append(result, line)
+			continue
+		}
 		// Check for +INCLUDE directive only at top level (depth 0)
-		if includeDepth == 0 && regexpIncludeDirective().MatchString(strings.TrimSpace(line)) {
-			matches := regexpIncludeDirective().FindStringSubmatch(strings.TrimSpace(line))
+		if includeDepth == 0 && regexpIncludeDirective().MatchString(directiveText(line)) {
+			matches := regexpIncludeDirective().FindStringSubmatch(directiveText(line))
 			if len(matches) > 0 {
 				includePath := matches[includePathIndex]
 				var canonicalPath string
@@ -174,19 +324,7 @@ func processIncludeDirectivesWithLoopDetection(sourceMD []byte, visited map[stri
 				var err error
 
 				// Find the corresponding +END directive first
-				endIndex := -1
-				tempDepth := 1
-				for j := i + 1; j < len(lines); j++ {
-					if regexpIncludeDirective().MatchString(strings.TrimSpace(lines[j])) {
-						tempDepth++
-					} else if regexpEndDirective().MatchString(strings.TrimSpace(lines[j])) {
-						tempDepth--
-						if tempDepth == 0 {
-							endIndex = j
-							break
-						}
-					}
-				}
+				endIndex := findIncludeEnd(lines, inCode, i)
 				if endIndex == -1 {
 					// No matching +END found, just add the line as-is
 					result = append(result, line)
@@ -196,12 +334,27 @@ func processIncludeDirectivesWithLoopDetection(sourceMD []byte, visited map[stri
 				// Add the +INCLUDE directive line
 				result = append(result, line)
 
+				var integrity string
+				var filters []lineFilter
+				var hide bool
+				args, err := parseDirectiveArgs(matches[includeArgsIndex])
+				if err == nil {
+					integrity, _ = args.get(integrityOptionKey)
+					filters, hide, err = parseLineFilters(args, params.config)
+				}
+
+				if err != nil {
+					params.warnf("%v", err)
+				} else
 				// Check if includePath is a URL and allowRemote is enabled
-				if allowRemote && isURL(includePath) {
+				if params.allowRemote && isURL(includePath) {
 					// Use URL as canonical path for cycle detection
 					canonicalPath = includePath
 					// Fetch content from URL
-					includeContent, err = fetchURL(includePath)
+					includeContent, err = fetchURL(includePath, integrity, &params.remotePolicy)
+					if err != nil && !errors.Is(err, ErrIntegrityMismatch) {
+						params.warnf("failed to include %s: %v", includePath, err)
+					}
 				} else {
 					// Get canonical path for cycle detection (local file)
 					canonicalPath, err = filepath.Abs(includePath)
@@ -219,6 +372,14 @@ func processIncludeDirectivesWithLoopDetection(sourceMD []byte, visited map[stri
 					}
 					// Read local file
 					includeContent, err = os.ReadFile(includePath)
+					if err == nil && integrity != "" {
+						if err = verifyIntegrity(includeContent, integrity); err != nil {
+							err = fmt.Errorf("%s: %w", includePath, err)
+						}
+					}
+				}
+				if errors.Is(err, ErrIntegrityMismatch) {
+					errs = append(errs, err)
 				}
 
 				// Check for cycles using canonical path
@@ -235,16 +396,35 @@ func processIncludeDirectivesWithLoopDetection(sourceMD []byte, visited map[stri
 
 				// Process the content if successfully read/fetched
 				if err == nil {
+					// Apply the filters to the lines of the content
+					filteredLines, _, filterErr := filterLines(splitLines(includeContent), filters, hide)
+					if filterErr != nil {
+						params.warnf("%s: %v", includePath, filterErr)
+					}
+					includeContent = append(bytes.Join(filteredLines, []byte("\n")), '\n')
+					// Substitute the parameters of the directive for the placeholders in the content
+					if includeParams := includeParameters(args); len(includeParams) > 0 {
+						substituted, undefined := substitutePlaceholders(string(includeContent), includeParams)
+						for _, name := range undefined {
+							params.warnf("undefined placeholder {{%s}} in %s", name, includePath)
+						}
+						includeContent = []byte(substituted)
+					}
 					// Mark this canonical path as visited to prevent cycles
 					newVisited := make(map[string]bool)
 					maps.Copy(newVisited, visited)
 					newVisited[canonicalPath] = true
 					// Recursively process the included content for nested includes
-					processedContent := processIncludeDirectivesWithLoopDetection(includeContent, newVisited, allowRemote)
+					processedContent, err2 := processIncludeDirectivesWithLoopDetection(includeContent, newVisited, params)
+					if err2 != nil {
+						errs = append(errs, err2)
+					}
 					// Add the processed content (without trailing newline to avoid extra blank lines)
 					content := strings.TrimRight(string(processedContent), "\n")
 					if content != "" {
-						result = append(result, content)
+						// Keep the content inside the container of the directive
+						prefix, _ := splitContainerPrefix(line)
+						result = append(result, prefixLines(content, continuationPrefix(prefix)))
 					}
 				} else {
 					// File not found or fetch failed, preserve existing content between directives
@@ -261,22 +441,42 @@ func processIncludeDirectivesWithLoopDetection(sourceMD []byte, visited map[stri
 		}
 
 		// Track include depth for nested directives
-		if regexpIncludeDirective().MatchString(strings.TrimSpace(line)) {
+		if regexpIncludeDirective().MatchString(directiveText(line)) {
 			includeDepth++
-		} else if regexpEndDirective().MatchString(strings.TrimSpace(line)) {
+		} else if regexpEndDirective().MatchString(directiveText(line)) {
 			includeDepth--
 		}
 
 		result = append(result, line)
 	}
-	return []byte(strings.Join(result, "\n"))
+	return []byte(strings.Join(result, "\n")), errors.Join(errs...)
 }
 
 // processParams holds configuration parameters.
 type processParams struct {
-	verbose     bool
-	debug       bool
-	allowRemote bool
+	verbose          bool
+	debug            bool
+	allowRemote      bool
+	remotePolicy     remotePolicy
+	diagnosticOutput io.Writer
+	config           *Config
+	computedTables   map[*gmextast.Table][][]string // The tables rewritten by directives, with the written values
+}
+
+// setComputedTable records the values that a directive wrote for the table.
+func (params *processParams) setComputedTable(table *gmextast.Table, tableData [][]string) {
+	if params.computedTables == nil {
+		params.computedTables = map[*gmextast.Table][][]string{}
+	}
+	params.computedTables[table] = tableData
+}
+
+// warnf reports a non-fatal problem to the diagnostic output, if any.
+func (params *processParams) warnf(format string, args ...any) {
+	if params.diagnosticOutput == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(params.diagnosticOutput, "warning: "+format+"\n", args...)
 }
 
 // Options is functional options type
@@ -297,13 +497,39 @@ var WithAllowRemote = funcopt.New(func(params *processParams, allowRemote bool)
 	params.allowRemote = allowRemote
 })
 
+// WithAllowHosts restricts remote INCLUDE directives to URLs that match one of the patterns. A pattern is either a hostname such as "*.example.com" or a URL prefix such as "https://raw.githubusercontent.com/knaka/".
+var WithAllowHosts = funcopt.New(func(params *processParams, patterns []string) {
+	params.remotePolicy.allow = append(params.remotePolicy.allow, patterns...)
+})
+
+// WithDenyHosts rejects remote INCLUDE directives for URLs that match one of the patterns, which take the same form as those of WithAllowHosts.
+var WithDenyHosts = funcopt.New(func(params *processParams, patterns []string) {
+	params.remotePolicy.deny = append(params.remotePolicy.deny, patterns...)
+})
+
+// WithConfig sets the configuration, which provides the defaults of directive options.
+var WithConfig = funcopt.New(func(params *processParams, config *Config) {
+	params.config = config
+})
+
+// WithDiagnosticOutput sets the writer that receives warnings about directives that could not be applied.
+var WithDiagnosticOutput = funcopt.New(func(params *processParams, writer io.Writer) {
+	params.diagnosticOutput = writer
+})
+
 // Process parses the source markdown, detects directives in HTML comments, applies modifications, and writes the result to the writer. If dirPathOpt is not nil, it changes the working directory to that path before processing.
 //
 // Supported directives:
 //   - INCLUDE ... END : Include the content of an external Markdown file.
 //   - SYNC_TITLE | TITLE : Extract the title from the linked Markdown file and use it as the link title.
-//   - MLR | MILLER : Processes the table above the comment using a Miller script.
+//   - MLR | MILLER : Processes the table above the comment using a Miller put expression or a chain of Miller verbs.
 //   - CODE : Reads the content of the file specified and writes it as a code block.
+//   - CODEDIFF : Writes the unified diff of two files as a code block.
+//   - GOEXAMPLE : Writes the code and optionally the expected output of a Go example function as code blocks.
+//   - VALUE : Replaces the preceding code span with a value selected from a JSON, YAML, TOML or go.mod file.
+//   - GOAPI : Replaces the preceding table with the exported API of a Go package.
+//   - TABLE_EXPORT : Writes the values of the preceding table to a CSV, TSV or JSON file.
+//   - SQL : Replaces the preceding table with the result set of a query against a SQLite database or CSV/TSV files.
 //
 // Planned features:
 //   - H1INCLUDE, H2INCLUDE, ...
@@ -318,6 +544,9 @@ func Process(
 	if err = funcopt.Apply(&params, opts); err != nil {
 		return
 	}
+	if params.config == nil {
+		params.config = &Config{}
+	}
 	if params.debug {
 		pp.SetDefaultOutput(os.Stderr)
 		if !term.IsTerminal(int(os.Stderr.Fd())) {
@@ -336,7 +565,8 @@ func Process(
 		}
 	}
 	// First, parse and process +INCLUDE ... +END directive
-	sourceMD = processIncludeDirectives(sourceMD, params.allowRemote)
+	sourceMD, includeErr := processIncludeDirectives(sourceMD, &params)
+	defer (func() { err = errors.Join(err, includeErr) })()
 
 	// Then, parse the other directives
 	gmTree, _ := gmParse(sourceMD)
@@ -362,7 +592,7 @@ func Process(
 			// +MILLER | +MLR directive
 			if matches := regexpMillerDirective().FindStringSubmatch(text); len(matches) > 0 {
 				mlrScript := matches[millerScriptIndex]
-				cursor = processMillerTable(sourceMD, writer, cursor, htmlBlockNode, mlrScript)
+				cursor = processMillerTable(sourceMD, writer, cursor, htmlBlockNode, mlrScript, &params)
 			} else
 			// +TBLFM directive
 			if matches := regexpTBLFMDirective().FindStringSubmatch(text); len(matches) > 0 {
@@ -371,23 +601,36 @@ func Process(
 				for _, line := range strings.Split(tblfmScript, "\n") {
 					tblfmScripts = append(tblfmScripts, strings.Split(line, "::")...)
 				}
-				cursor = processTBLFMTable(sourceMD, writer, cursor, htmlBlockNode, tblfmScripts)
+				cursor = processTBLFMTable(sourceMD, writer, cursor, htmlBlockNode, tblfmScripts, &params)
 			} else
 			// +TABLE_INCLUDE | +TINCLUDE directive
 			if matches := regexpTableIncludeDirective().FindStringSubmatch(text); len(matches) > 0 {
-				filePath := strings.TrimSpace(matches[tableIncludeFilePathIndex])
-				cursor = processTableInclude(sourceMD, writer, cursor, htmlBlockNode, filePath)
+				argsText := matches[tableIncludeArgsIndex]
+				cursor = processTableInclude(sourceMD, writer, cursor, htmlBlockNode, argsText, &params)
 			} else
 			// +CODE directive
 			if matches := regexpCodeDirective().FindStringSubmatch(text); len(matches) > 0 {
-				codePath := matches[codeSrcIndex]
-				newCursor := processFencedCodeBlock(sourceMD, writer, cursor, htmlBlockNode, codePath)
-				if newCursor > cursor {
-					cursor = newCursor
-				} else {
-					// Fenced code block processing failed, try indented code block
-					cursor = processIndentedCodeBlock(sourceMD, writer, cursor, htmlBlockNode, codePath)
-				}
+				cursor = processCodeDirective(sourceMD, writer, cursor, htmlBlockNode, matches[codeSrcIndex], matches[codeArgsIndex], &params)
+			} else
+			// +CODEDIFF directive
+			if matches := regexpCodeDiffDirective().FindStringSubmatch(text); len(matches) > 0 {
+				cursor = processCodeDiffDirective(sourceMD, writer, cursor, htmlBlockNode, matches[codeDiffArgsIndex], &params)
+			} else
+			// +GOEXAMPLE directive
+			if matches := regexpGoExampleDirective().FindStringSubmatch(text); len(matches) > 0 {
+				cursor = processGoExampleDirective(sourceMD, writer, cursor, htmlBlockNode, matches[goExampleArgsIndex], &params)
+			} else
+			// +GOAPI directive
+			if matches := regexpGoAPIDirective().FindStringSubmatch(text); len(matches) > 0 {
+				cursor = processGoAPIDirective(sourceMD, writer, cursor, htmlBlockNode, matches[goAPIArgsIndex], &params)
+			} else
+			// +SQL directive
+			if matches := regexpSQLDirective().FindStringSubmatch(text); len(matches) > 0 {
+				cursor = processSQLDirective(sourceMD, writer, cursor, htmlBlockNode, matches[sqlArgsIndex], &params)
+			} else
+			// +TABLE_EXPORT directive
+			if matches := regexpTableExportDirective().FindStringSubmatch(text); len(matches) > 0 {
+				cursor = processTableExportDirective(sourceMD, cursor, htmlBlockNode, matches[tableExportArgsIndex], &params)
 			}
 		case gmast.KindRawHTML:
 			rawHTMLNode, _ := node.(*gmast.RawHTML)
@@ -402,6 +645,10 @@ func Process(
 			// +TITLE directive gets the link path from the previous link node
 			if matches := regexpSyncTitleDirective().FindStringSubmatch(text); len(matches) > 0 {
 				cursor = processSyncTitleDirective(sourceMD, writer, cursor, node, segments)
+			} else
+			// +VALUE directive gets the value for the previous code span node
+			if matches := regexpValueDirective().FindStringSubmatch(text); len(matches) > 0 {
+				cursor = processValueDirective(sourceMD, writer, cursor, node, segments, matches[valueArgsIndex], &params)
 			}
 		}
 		return gmast.WalkContinue, nil
@@ -2,7 +2,12 @@ package mdpp
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/andreyvit/diff"
 	"github.com/stretchr/testify/assert"
@@ -10,12 +15,21 @@ import (
 	. "github.com/knaka/go-utils"
 )
 
+// helloC is the content of testdata/hello.c.
+const helloC = `#include <stdio.h>
+
+int main (int argc, char** argv) {
+  printf("Hello!\n");
+}
+`
+
 func TestPrefixedMillerTable(t *testing.T) {
 	tests := []struct {
 		run        bool
 		name       string
 		sourceMD   []byte
 		expectedMD []byte
+		diagnostic string
 	}{
 		{
 			run:  true,
@@ -36,11 +50,11 @@ bar
 `),
 			expectedMD: []byte(`foo
 
-| Item | UnitPrice | Quantity | Total |
-| --- | --- | --- | --- |
-| Apple | 2.5 | 12 | 30 |
-| Banana | 2.0 | 5 | 10 |
-| Orange | 1.2 | 8 | 9.6 |
+| Item   | UnitPrice | Quantity | Total |
+| ------ | --------- | -------- | ----- |
+| Apple  | 2.5       | 12       | 30    |
+| Banana | 2.0       | 5        | 10    |
+| Orange | 1.2       | 8        | 9.6   |
 
 <!-- +mlr:
   $Total = $UnitPrice * $Quantity
@@ -66,17 +80,261 @@ bar
 `),
 			expectedMD: []byte(`foo
 
-> | Item | UnitPrice | Quantity | Total |
-> | --- | --- | --- | --- |
-> | Apple | 1.5 | 12 | 18 |
-> | Banana | 2.0 | 5 | 10 |
-> | Orange | 1.2 | 8 | 9.6 |
+> | Item   | UnitPrice | Quantity | Total |
+> | ------ | --------- | -------- | ----- |
+> | Apple  | 1.5       | 12       | 18    |
+> | Banana | 2.0       | 5        | 10    |
+> | Orange | 1.2       | 8        | 9.6   |
 >
 > <!-- +Miller: $Total = $UnitPrice * $Quantity -->
 
 bar
 `),
 		},
+		{
+			run:  true,
+			name: "Verb chain",
+			sourceMD: []byte(`| Item | UnitPrice | Quantity |
+| --- | --- | --- |
+| Apple | 2.5 | 12 |
+| Banana | 2.0 | 5 |
+| Orange | 1.2 | 8 |
+
+<!-- +MLR: put '$Total = $UnitPrice * $Quantity' then sort -nr Total then head -n 2 -->
+`),
+			expectedMD: []byte(`| Item   | UnitPrice | Quantity | Total |
+| ------ | --------- | -------- | ----- |
+| Apple  | 2.5       | 12       | 30    |
+| Banana | 2.0       | 5        | 10    |
+
+<!-- +MLR: put '$Total = $UnitPrice * $Quantity' then sort -nr Total then head -n 2 -->
+`),
+		},
+		{
+			run:  true,
+			name: "Multi-line verb chain",
+			sourceMD: []byte(`| Team | Score |
+| --- | --- |
+| Red | 3 |
+| Blue | 5 |
+| Red | 4 |
+
+<!-- +MLR:
+  stats1 -a sum,count -f Score -g Team
+  then sort -f Team
+-->
+`),
+			expectedMD: []byte(`| Team | Score_sum | Score_count |
+| ---- | --------- | ----------- |
+| Blue | 5         | 1           |
+| Red  | 7         | 2           |
+
+<!-- +MLR:
+  stats1 -a sum,count -f Score -g Team
+  then sort -f Team
+-->
+`),
+		},
+		{
+			run:  true,
+			name: "Expression with minus signs",
+			sourceMD: []byte(`| Item | Price | Discount | Net |
+| --- | --- | --- | --- |
+| Apple | 10 | 2 | 0 |
+
+<!-- +MLR: $Net = $Price - $Discount -->
+`),
+			expectedMD: []byte(`| Item  | Price | Discount | Net |
+| ----- | ----- | -------- | --- |
+| Apple | 10    | 2        | 8   |
+
+<!-- +MLR: $Net = $Price - $Discount -->
+`),
+		},
+		{
+			run:  true,
+			name: "No records left",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+
+<!-- +MLR: filter $Price > 100 -->
+`),
+			expectedMD: []byte(`| Item | Price |
+| ---- | ----- |
+
+<!-- +MLR: filter $Price > 100 -->
+`),
+		},
+		{
+			run:  true,
+			name: "Unknown verb",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+
+<!-- +MLR: sort -f Item then frobnicate -->
+`),
+			expectedMD: []byte(`| Item  | Price |
+| ----- | ----- |
+| Apple | 10    |
+
+<!-- +MLR: sort -f Item then frobnicate -->
+`),
+			diagnostic: "MILLER: verb not found: frobnicate",
+		},
+		{
+			run:  true,
+			name: "Put expression starting with filter",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+| Banana | 3 |
+
+<!-- +MLR: filter $Price > 5 -->
+`),
+			expectedMD: []byte(`| Item  | Price |
+| ----- | ----- |
+| Apple | 10    |
+
+<!-- +MLR: filter $Price > 5 -->
+`),
+		},
+		{
+			run:  true,
+			name: "Put expression with an apostrophe",
+			sourceMD: []byte(`| Item | Note |
+| --- | --- |
+| Apple |  |
+
+<!-- +MLR: $Note = "it's red" -->
+`),
+			expectedMD: []byte(`| Item  | Note     |
+| ----- | -------- |
+| Apple | it's red |
+
+<!-- +MLR: $Note = "it's red" -->
+`),
+		},
+		{
+			run:  true,
+			name: "Verb chain starting with then",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+| Banana | 3 |
+
+<!-- +MLR: then filter '$Price < 5' then put '$Note = "cheap"' -->
+`),
+			expectedMD: []byte(`| Item   | Price | Note  |
+| ------ | ----- | ----- |
+| Banana | 3     | cheap |
+
+<!-- +MLR: then filter '$Price < 5' then put '$Note = "cheap"' -->
+`),
+		},
+		{
+			run:  true,
+			name: "Arguments that no verb takes",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+
+<!-- +MLR: head -n 1 extra -->
+`),
+			expectedMD: []byte(`| Item  | Price |
+| ----- | ----- |
+| Apple | 10    |
+
+<!-- +MLR: head -n 1 extra -->
+`),
+			diagnostic: "MILLER: unexpected arguments: extra",
+		},
+		{
+			run:  true,
+			name: "Then without a verb",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+
+<!-- +MLR: sort -f Item then -->
+`),
+			expectedMD: []byte(`| Item  | Price |
+| ----- | ----- |
+| Apple | 10    |
+
+<!-- +MLR: sort -f Item then -->
+`),
+			diagnostic: "MILLER: then requires a verb",
+		},
+		{
+			run:  true,
+			name: "Invalid option of a verb",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+
+<!-- +MLR: sort -zz Item -->
+`),
+			expectedMD: []byte(`| Item  | Price |
+| ----- | ----- |
+| Apple | 10    |
+
+<!-- +MLR: sort -zz Item -->
+`),
+			diagnostic: "MILLER: invalid options: mlr sort",
+		},
+		{
+			run:  true,
+			name: "Invalid value of an option",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+
+<!-- +MLR: head -n many -->
+`),
+			expectedMD: []byte(`| Item  | Price |
+| ----- | ----- |
+| Apple | 10    |
+
+<!-- +MLR: head -n many -->
+`),
+			diagnostic: "MILLER: mlr head: could not scan flag",
+		},
+		{
+			run:  true,
+			name: "Help option",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+
+<!-- +MLR: head -h -->
+`),
+			expectedMD: []byte(`| Item  | Price |
+| ----- | ----- |
+| Apple | 10    |
+
+<!-- +MLR: head -h -->
+`),
+			diagnostic: "MILLER: help option is not available",
+		},
+		{
+			run:  true,
+			name: "Invalid put expression",
+			sourceMD: []byte(`| Item | Price |
+| --- | --- |
+| Apple | 10 |
+
+<!-- +MLR: $Total = = 1 -->
+`),
+			expectedMD: []byte(`| Item  | Price |
+| ----- | ----- |
+| Apple | 10    |
+
+<!-- +MLR: $Total = = 1 -->
+`),
+			diagnostic: "MILLER: mlr: cannot parse DSL expression",
+		},
 	}
 
 	for _, tt := range tests {
@@ -86,12 +344,18 @@ bar
 		}
 		t.Run(tt.name, func(t *testing.T) {
 			writer := bytes.NewBuffer(nil)
-			V0(Process(tt.sourceMD, writer, nil))
+			diagnostics := bytes.NewBuffer(nil)
+			V0(Process(tt.sourceMD, writer, nil, WithDiagnosticOutput(diagnostics)))
 			if !bytes.Equal(tt.expectedMD, writer.Bytes()) {
 				t.Fatalf(`Unmatched for %s:
 
 %s`, tt.name, diff.LineDiff(string(tt.expectedMD), writer.String()))
 			}
+			if tt.diagnostic == "" {
+				assert.Empty(t, diagnostics.String())
+			} else {
+				assert.Contains(t, diagnostics.String(), tt.diagnostic)
+			}
 		})
 	}
 }
@@ -120,12 +384,12 @@ bar
 `),
 			expectedMD: []byte(`foo
 
-| Item | UnitPrice | Quantity | Total |
-| :---: | --- | --- | :--- |
-| Apple | 2.5 | 12 | 30 |
-| Banana | 2.0 | 5 | 10 |
-| Orange | 1.2 | 8 | 9.6 |
-|  |  |  | 49.6 |
+|  Item  | UnitPrice | Quantity | Total |
+| :----: | --------- | -------- | :---- |
+| Apple  | 2.5       | 12       | 30    |
+| Banana | 2.0       | 5        | 10    |
+| Orange | 1.2       | 8        | 9.6   |
+|        |           |          | 49.6  |
 <!-- +TBLFM: @2$>..@>>$>=$2*$3::@>$>=vsum(@<<..@>>) -->
 
 bar
@@ -152,12 +416,12 @@ bar
 `),
 			expectedMD: []byte(`foo
 
-> | Item | UnitPrice | Quantity | Total |
-> | --- | --- | --- | --- |
-> | Apple | 2.5 | 12 | 30 |
-> | Banana | 2.0 | 5 | 10 |
-> | Orange | 1.2 | 8 | 9.6 |
-> |  |  |  | 49.6 |
+> | Item   | UnitPrice | Quantity | Total |
+> | ------ | --------- | -------- | ----- |
+> | Apple  | 2.5       | 12       | 30    |
+> | Banana | 2.0       | 5        | 10    |
+> | Orange | 1.2       | 8        | 9.6   |
+> |        |           |          | 49.6  |
 > 
 > <!-- +TBLFM:
 >   @2$>..@>>$>=$2*$3
@@ -207,14 +471,62 @@ Done.
 `),
 			expectedMD: []byte(`Test table from CSV:
 
-| Name | Age | City |
-| --- | --- | --- |
-| Alice | 30 | Tokyo |
-| Bob | 25 | Osaka, Los Angeles "City of Angels" |
-| Charlie | 35 | Kyoto |
+| Name    | Age | City                                |
+| ------- | --- | ----------------------------------- |
+| Alice   | 30  | Tokyo                               |
+| Bob     | 25  | Osaka, Los Angeles "City of Angels" |
+| Charlie | 35  | Kyoto                               |
 <!-- +TABLE_INCLUDE: testdata/test_table.csv -->
 
 Done.
+`),
+		},
+		{
+			run:  true,
+			name: "Unquoted path with spaces",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/test table.csv -->
+`),
+			expectedMD: []byte(`| Name    | Age | City                                |
+| ------- | --- | ----------------------------------- |
+| Alice   | 30  | Tokyo                               |
+| Bob     | 25  | Osaka, Los Angeles "City of Angels" |
+| Charlie | 35  | Kyoto                               |
+<!-- +TABLE_INCLUDE: testdata/test table.csv -->
+`),
+		},
+		{
+			run:  true,
+			name: "Unquoted path with an equals sign",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/region=all.csv -->
+`),
+			expectedMD: []byte(`| Name    | Age | City                                |
+| ------- | --- | ----------------------------------- |
+| Alice   | 30  | Tokyo                               |
+| Bob     | 25  | Osaka, Los Angeles "City of Angels" |
+| Charlie | 35  | Kyoto                               |
+<!-- +TABLE_INCLUDE: testdata/region=all.csv -->
+`),
+		},
+		{
+			run:  true,
+			name: "Quoted path with spaces and options",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: "testdata/test table.csv" columns=Name -->
+`),
+			expectedMD: []byte(`| Name    |
+| ------- |
+| Alice   |
+| Bob     |
+| Charlie |
+<!-- +TABLE_INCLUDE: "testdata/test table.csv" columns=Name -->
 `),
 		},
 		{
@@ -232,13 +544,325 @@ Done.
 			expectedMD: []byte(`Test table from TSV:
 
 | Product | Price | Quantity |
-| :---: | :--- | --- |
-| Apple | 100 | 5 |
-| Banana | 80 | 10 |
-| Orange | 120 | 3 |
+| :-----: | :---- | -------- |
+|  Apple  | 100   | 5        |
+| Banana  | 80    | 10       |
+| Orange  | 120   | 3        |
 <!-- +TINCLUDE: testdata/test_table.tsv -->
 
 Done.
+`),
+		},
+		{
+			run:  true,
+			name: "Column selection, renaming and alignment",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/test_table.csv columns=City,1,Age rename=Age:Years align=left,none,right -->
+`),
+			expectedMD: []byte(`| City                                | Name    | Years |
+| :---------------------------------- | ------- | ----: |
+| Tokyo                               | Alice   |    30 |
+| Osaka, Los Angeles "City of Angels" | Bob     |    25 |
+| Kyoto                               | Charlie |    35 |
+<!-- +TABLE_INCLUDE: testdata/test_table.csv columns=City,1,Age rename=Age:Years align=left,none,right -->
+`),
+		},
+		{
+			run:  true,
+			name: "Alignment by column name",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/test_table.tsv columns=Product,Price align=Price:right -->
+`),
+			expectedMD: []byte(`| Product | Price |
+| ------- | ----: |
+| Apple   |   100 |
+| Banana  |    80 |
+| Orange  |   120 |
+<!-- +TABLE_INCLUDE: testdata/test_table.tsv columns=Product,Price align=Price:right -->
+`),
+		},
+		{
+			run:  true,
+			name: "Top rows by numeric sort",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/downloads.csv sort=-Downloads,Package limit=3 -->
+`),
+			expectedMD: []byte(`| Package | Category | Downloads |
+| ------- | -------- | --------- |
+| gamma   | tool     | 15000     |
+| zeta    | tool     | 15000     |
+| alpha   | tool     | 1200      |
+<!-- +TABLE_INCLUDE: testdata/downloads.csv sort=-Downloads,Package limit=3 -->
+`),
+		},
+		{
+			run:  true,
+			name: "Filtering with where",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/downloads.csv where=Category==tool where="Downloads >= 1000" columns=Package -->
+`),
+			expectedMD: []byte(`| Package |
+| ------- |
+| alpha   |
+| gamma   |
+| zeta    |
+<!-- +TABLE_INCLUDE: testdata/downloads.csv where=Category==tool where="Downloads >= 1000" columns=Package -->
+`),
+		},
+		{
+			run:  true,
+			name: "Distinct values of selected columns",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/downloads.csv columns=Category distinct sort=Category -->
+`),
+			expectedMD: []byte(`| Category |
+| -------- |
+| library  |
+| tool     |
+<!-- +TABLE_INCLUDE: testdata/downloads.csv columns=Category distinct sort=Category -->
+`),
+		},
+		{
+			run:  true,
+			name: "JSON array of objects",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/packages.json -->
+`),
+			expectedMD: []byte(`| name  | version | author.name | author.email    | tags         | private |
+| ----- | ------- | ----------- | --------------- | ------------ | ------- |
+| alpha | 1.0     | Ann         | ann@example.com | ["cli","go"] |         |
+| beta  | 2.1.3   | Bob         |                 |              | true    |
+<!-- +TABLE_INCLUDE: testdata/packages.json -->
+`),
+		},
+		{
+			run:  true,
+			name: "JSON Lines",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/events.jsonl -->
+`),
+			expectedMD: []byte(`| time  | level | message          | context.ms |
+| ----- | ----- | ---------------- | ---------- |
+| 10:00 | info  | started          |            |
+| 10:05 | warn  | slow \| response | 1500       |
+<!-- +TABLE_INCLUDE: testdata/events.jsonl -->
+`),
+		},
+		{
+			run:  true,
+			name: "YAML sequence of mappings",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/team.yaml -->
+`),
+			expectedMD: []byte(`| name  | role      | since | location.city |
+| ----- | --------- | ----- | ------------- |
+| 鈴木  | Lead      | 2019  |               |
+| Smith | Developer |       | Tokyo         |
+<!-- +TABLE_INCLUDE: testdata/team.yaml -->
+`),
+		},
+		{
+			run:  true,
+			name: "Format override",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/events.log format=jsonl columns=level -->
+`),
+			expectedMD: []byte(`| level |
+| ----- |
+| info  |
+| warn  |
+<!-- +TABLE_INCLUDE: testdata/events.log format=jsonl columns=level -->
+`),
+		},
+		{
+			run:  true,
+			name: "Unsupported extension keeps the table",
+			sourceMD: []byte(`| Old |
+| --- |
+| x   |
+<!-- +TABLE_INCLUDE: testdata/events.log -->
+`),
+			expectedMD: []byte(`| Old |
+| --- |
+| x   |
+<!-- +TABLE_INCLUDE: testdata/events.log -->
+`),
+		},
+		{
+			run:  true,
+			name: "Excel sheet and range with calculated formulas",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/pricing.xlsx sheet=Pricing range=A1:D4 -->
+`),
+			expectedMD: []byte(`| Plan  | Seats | Price | Total |
+| ----- | ----- | ----- | ----- |
+| Basic | 5     | 10    | 50    |
+| Pro   | 10    | 25    | 250   |
+| Team  | 50    | 20    | 1000  |
+<!-- +TABLE_INCLUDE: testdata/pricing.xlsx sheet=Pricing range=A1:D4 -->
+`),
+		},
+		{
+			run:  true,
+			name: "Excel first sheet",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/pricing.xlsx -->
+`),
+			expectedMD: []byte(`| See Pricing |
+| ----------- |
+<!-- +TABLE_INCLUDE: testdata/pricing.xlsx -->
+`),
+		},
+		{
+			run:  true,
+			name: "OpenDocument spreadsheet",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/pricing.ods sheet=Pricing -->
+`),
+			expectedMD: []byte(`| Plan        | Seats | Price | Total |
+| ----------- | ----- | ----- | ----- |
+| Basic  plan | 5     | 10    | 50    |
+| Same        | 1     | 1     | 1     |
+| Same        | 1     | 1     | 1     |
+<!-- +TABLE_INCLUDE: testdata/pricing.ods sheet=Pricing -->
+`),
+		},
+		{
+			run:  true,
+			name: "Unknown sheet keeps the table",
+			sourceMD: []byte(`| Old |
+| --- |
+| x   |
+<!-- +TABLE_INCLUDE: testdata/pricing.ods sheet=Costs -->
+`),
+			expectedMD: []byte(`| Old |
+| --- |
+| x   |
+<!-- +TABLE_INCLUDE: testdata/pricing.ods sheet=Costs -->
+`),
+		},
+		{
+			run:  true,
+			name: "Semicolon delimiter and comment lines",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/european.csv delimiter=; comment=# -->
+`),
+			expectedMD: []byte(`| Product    | Price |
+| ---------- | ----- |
+| Apple; red | 1,50  |
+| Pear       | 0,80  |
+<!-- +TABLE_INCLUDE: testdata/european.csv delimiter=; comment=# -->
+`),
+		},
+		{
+			run:  true,
+			name: "Shift_JIS without header row",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/shift_jis.csv encoding=shift_jis headers=品名 -->
+`),
+			expectedMD: []byte(`| 品名   | Column2 |
+| ------ | ------- |
+| りんご | 100     |
+| みかん | 80      |
+<!-- +TABLE_INCLUDE: testdata/shift_jis.csv encoding=shift_jis headers=品名 -->
+`),
+		},
+		{
+			run:  true,
+			name: "UTF-16 TSV with quoted fields",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/utf16.tsv encoding=utf-16 quote -->
+`),
+			expectedMD: []byte("| Name | Note     |\n| ---- | -------- |\n| A    | tab\there |\n| B    | plain    |\n" +
+				"<!-- +TABLE_INCLUDE: testdata/utf16.tsv encoding=utf-16 quote -->\n"),
+		},
+		{
+			run:  true,
+			name: "Skipped lines and generated header",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/report.csv skip=3 header=none -->
+`),
+			expectedMD: []byte(`| Column1 | Column2 |
+| ------- | ------- |
+| Jan     | 10      |
+| Feb     | 12      |
+<!-- +TABLE_INCLUDE: testdata/report.csv skip=3 header=none -->
+`),
+		},
+		{
+			run:  true,
+			name: "Lazy quotes",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/lazy.csv lazyquotes -->
+`),
+			expectedMD: []byte(`| Name | Quote              |
+| ---- | ------------------ |
+| Bob  | He said "hi" twice |
+<!-- +TABLE_INCLUDE: testdata/lazy.csv lazyquotes -->
+`),
+		},
+		{
+			run:  true,
+			name: "Blank lines and comments in TSV",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/blank_lines.tsv comment=# -->
+`),
+			expectedMD: []byte(`| Step | Note  |
+| ---- | ----- |
+| 1    | start |
+|      |       |
+| 3    | end   |
+<!-- +TABLE_INCLUDE: testdata/blank_lines.tsv comment=# -->
+`),
+		},
+		{
+			run:  true,
+			name: "Unknown column keeps the table",
+			sourceMD: []byte(`| Old |
+| --- |
+| x |
+<!-- +TABLE_INCLUDE: testdata/test_table.csv columns=Country -->
+`),
+			expectedMD: []byte(`| Old |
+| --- |
+| x   |
+<!-- +TABLE_INCLUDE: testdata/test_table.csv columns=Country -->
 `),
 		},
 	}
@@ -498,29 +1122,142 @@ This file includes File A using different path representation:
 End of canonical test.
 `),
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// First run
-			output1 := bytes.NewBuffer(nil)
-			if err := Process(tt.input, output1, nil); err != nil {
-				t.Fatal("error on first run")
-			}
-			if !bytes.Equal(tt.expected, output1.Bytes()) {
-				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(string(tt.expected), output1.String()))
-			}
+		{
+			name: "include in blockquote",
+			input: []byte(`# Quote
 
-			// Second run for idempotency test
-			output2 := bytes.NewBuffer(nil)
-			if err := Process(output1.Bytes(), output2, nil); err != nil {
-				t.Fatal("error on second run")
-			}
-			if !bytes.Equal(output1.Bytes(), output2.Bytes()) {
-				t.Fatalf(`Process is not idempotent for %s:\n\n%s`, tt.name, diff.LineDiff(output1.String(), output2.String()))
-			}
-		})
-	}
-}
+> Quoted:
+>
+> <!-- +INCLUDE: testdata/nested_level2.md -->
+> <!-- +END -->
+
+Done.
+`),
+			expected: []byte(`# Quote
+
+> Quoted:
+>
+> <!-- +INCLUDE: testdata/nested_level2.md -->
+> ## Level 2 Content
+>
+> This is the deepest level of nesting.
+> <!-- +END -->
+
+Done.
+`),
+		},
+		{
+			name: "nested include in list item",
+			input: []byte(`# List
+
+- Item:
+
+  <!-- +INCLUDE: testdata/nested_level1.md -->
+  <!-- +END -->
+- <!-- +INCLUDE: testdata/nested_level2.md -->
+  <!-- +END -->
+`),
+			expected: []byte(`# List
+
+- Item:
+
+  <!-- +INCLUDE: testdata/nested_level1.md -->
+  # Level 1 Content
+
+  This includes content from level 2:
+
+  <!-- +INCLUDE: testdata/nested_level2.md -->
+  ## Level 2 Content
+
+  This is the deepest level of nesting.
+  <!-- +END -->
+
+  End of level 1.
+  <!-- +END -->
+- <!-- +INCLUDE: testdata/nested_level2.md -->
+  ## Level 2 Content
+
+  This is the deepest level of nesting.
+  <!-- +END -->
+`),
+		},
+		{
+			name: "directive in fenced code block in list item",
+			input: []byte(`- Example:
+
+  ` + "```" + `markdown
+  <!-- +INCLUDE: testdata/nested_level2.md -->
+  <!-- +END -->
+  ` + "```" + `
+`),
+			expected: []byte(`- Example:
+
+  ` + "```" + `markdown
+  <!-- +INCLUDE: testdata/nested_level2.md -->
+  <!-- +END -->
+  ` + "```" + `
+`),
+		},
+		{
+			name: "directives in fenced and indented code blocks",
+			input: []byte(`Fenced:
+
+` + "````" + `markdown
+<!-- +INCLUDE: testdata/nested_level2.md -->
+<!-- +END -->
+` + "````" + `
+
+Indented:
+
+    <!-- +INCLUDE: testdata/nested_level2.md -->
+    <!-- +END -->
+
+- Indented in list item:
+
+      <!-- +INCLUDE: testdata/nested_level2.md -->
+      <!-- +END -->
+`),
+			expected: []byte(`Fenced:
+
+` + "````" + `markdown
+<!-- +INCLUDE: testdata/nested_level2.md -->
+<!-- +END -->
+` + "````" + `
+
+Indented:
+
+    <!-- +INCLUDE: testdata/nested_level2.md -->
+    <!-- +END -->
+
+- Indented in list item:
+
+      <!-- +INCLUDE: testdata/nested_level2.md -->
+      <!-- +END -->
+`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// First run
+			output1 := bytes.NewBuffer(nil)
+			if err := Process(tt.input, output1, nil); err != nil {
+				t.Fatal("error on first run")
+			}
+			if !bytes.Equal(tt.expected, output1.Bytes()) {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(string(tt.expected), output1.String()))
+			}
+
+			// Second run for idempotency test
+			output2 := bytes.NewBuffer(nil)
+			if err := Process(output1.Bytes(), output2, nil); err != nil {
+				t.Fatal("error on second run")
+			}
+			if !bytes.Equal(output1.Bytes(), output2.Bytes()) {
+				t.Fatalf(`Process is not idempotent for %s:\n\n%s`, tt.name, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
 
 func TestCodeBlock(t *testing.T) {
 	tests := []struct {
@@ -647,3 +1384,1096 @@ func TestCodeBlock(t *testing.T) {
 		})
 	}
 }
+
+func TestIncludeIntegrity(t *testing.T) {
+	remoteContent := "# Remote Content\n\nFetched from the server.\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(remoteContent))
+	}))
+	defer server.Close()
+	digest := sha256Hex([]byte(remoteContent))
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "matching digest",
+			input: `<!-- +INCLUDE: ` + server.URL + ` sha256=` + digest + ` -->
+<!-- +END -->
+`,
+			expected: `<!-- +INCLUDE: ` + server.URL + ` sha256=` + digest + ` -->
+# Remote Content
+
+Fetched from the server.
+<!-- +END -->
+`,
+		},
+		{
+			name: "mismatching digest keeps old content",
+			input: `<!-- +INCLUDE: ` + server.URL + ` sha256=0000 -->
+Old content.
+<!-- +END -->
+`,
+			expected: `<!-- +INCLUDE: ` + server.URL + ` sha256=0000 -->
+Old content.
+<!-- +END -->
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := bytes.NewBuffer(nil)
+			err := Process([]byte(tt.input), output, nil, WithAllowRemote(true))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrIntegrityMismatch)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.expected != output.String() {
+				t.Fatalf(`Unmatched:\n\n%s`, diff.LineDiff(tt.expected, output.String()))
+			}
+		})
+	}
+}
+
+func TestPin(t *testing.T) {
+	remoteContent := "Remote content.\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(remoteContent))
+	}))
+	defer server.Close()
+	digest := sha256Hex([]byte(remoteContent))
+	input := `<!-- +INCLUDE: ` + server.URL + `/a.md -->
+<!-- +INCLUDE: ` + server.URL + `/nested.md -->
+<!-- +END -->
+<!-- +END -->
+
+<!-- +INCLUDE: ` + server.URL + `/b.md sha256=0123 -->
+<!-- +END -->
+
+<!-- +INCLUDE: ` + server.URL + `/c.md sha256=abc-->
+<!-- +END -->
+
+<!-- +INCLUDE: testdata/include_test.md -->
+<!-- +END -->
+`
+	expected := `<!-- +INCLUDE: ` + server.URL + `/a.md sha256=` + digest + ` -->
+<!-- +INCLUDE: ` + server.URL + `/nested.md -->
+<!-- +END -->
+<!-- +END -->
+
+<!-- +INCLUDE: ` + server.URL + `/b.md sha256=` + digest + ` -->
+<!-- +END -->
+
+<!-- +INCLUDE: ` + server.URL + `/c.md sha256=` + digest + `-->
+<!-- +END -->
+
+<!-- +INCLUDE: testdata/include_test.md -->
+<!-- +END -->
+`
+	output := bytes.NewBuffer(nil)
+	V0(Pin([]byte(input), output))
+	if expected != output.String() {
+		t.Fatalf(`Unmatched:\n\n%s`, diff.LineDiff(expected, output.String()))
+	}
+}
+
+func TestRemotePolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/public/doc.md", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("Public content.\n"))
+	})
+	mux.HandleFunc("/public/moved.md", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/private/doc.md", http.StatusFound)
+	})
+	mux.HandleFunc("/private/doc.md", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("Private content.\n"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	tests := []struct {
+		name       string
+		path       string
+		opts       Options
+		included   bool
+		diagnostic string
+	}{
+		{
+			name:     "allowed by hostname",
+			path:     "/public/doc.md",
+			opts:     Options{WithAllowHosts([]string{"127.0.0.1", "raw.githubusercontent.com"})},
+			included: true,
+		},
+		{
+			name:       "not in allowlist",
+			path:       "/public/doc.md",
+			opts:       Options{WithAllowHosts([]string{"*.example.com"})},
+			diagnostic: server.URL + "/public/doc.md",
+		},
+		{
+			name:       "denied by URL prefix",
+			path:       "/public/doc.md",
+			opts:       Options{WithDenyHosts([]string{server.URL + "/public"})},
+			diagnostic: server.URL + "/public/doc.md",
+		},
+		{
+			name:     "allowed by URL prefix",
+			path:     "/public/doc.md",
+			opts:     Options{WithAllowHosts([]string{server.URL + "/public/"})},
+			included: true,
+		},
+		{
+			name:       "redirect leaving the allowed set",
+			path:       "/public/moved.md",
+			opts:       Options{WithAllowHosts([]string{server.URL + "/public/"})},
+			diagnostic: server.URL + "/private/doc.md",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "<!-- +INCLUDE: " + server.URL + tt.path + " -->\nOld content.\n<!-- +END -->\n"
+			expected := input
+			if tt.included {
+				expected = "<!-- +INCLUDE: " + server.URL + tt.path + " -->\nPublic content.\n<!-- +END -->\n"
+			}
+			output := bytes.NewBuffer(nil)
+			diagnostics := bytes.NewBuffer(nil)
+			opts := append(Options{WithAllowRemote(true), WithDiagnosticOutput(diagnostics)}, tt.opts...)
+			V0(Process([]byte(input), output, nil, opts...))
+			if expected != output.String() {
+				t.Fatalf(`Unmatched:\n\n%s`, diff.LineDiff(expected, output.String()))
+			}
+			if tt.diagnostic == "" {
+				assert.Empty(t, diagnostics.String())
+			} else {
+				assert.Contains(t, diagnostics.String(), tt.diagnostic)
+			}
+		})
+	}
+}
+
+func TestRemotePolicyPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  remotePolicy
+		url     string
+		allowed bool
+	}{
+		{
+			name:    "denied host in upper case",
+			policy:  remotePolicy{deny: []string{"https://evil.example/"}},
+			url:     "https://EVIL.example/x",
+			allowed: false,
+		},
+		{
+			name:    "denied scheme in upper case",
+			policy:  remotePolicy{deny: []string{"https://evil.example"}},
+			url:     "HTTPS://evil.example/x",
+			allowed: false,
+		},
+		{
+			name:    "allowed prefix",
+			policy:  remotePolicy{allow: []string{"https://raw.githubusercontent.com/knaka/"}},
+			url:     "https://raw.githubusercontent.com/knaka/mdpp/main/README.md",
+			allowed: true,
+		},
+		{
+			name:    "dot segments leaving the allowed prefix",
+			policy:  remotePolicy{allow: []string{"https://raw.githubusercontent.com/knaka/"}},
+			url:     "https://raw.githubusercontent.com/knaka/../other/x",
+			allowed: false,
+		},
+		{
+			name:    "escaped dot segments leaving the allowed prefix",
+			policy:  remotePolicy{allow: []string{"https://raw.githubusercontent.com/knaka/"}},
+			url:     "https://raw.githubusercontent.com/knaka/%2e%2e/other/x",
+			allowed: false,
+		},
+		{
+			name:    "prefix ending within a segment",
+			policy:  remotePolicy{allow: []string{"https://example.com/docs"}},
+			url:     "https://example.com/docs-old/x",
+			allowed: false,
+		},
+		{
+			name:    "prefix ending at a segment",
+			policy:  remotePolicy{allow: []string{"https://example.com/docs"}},
+			url:     "https://example.com/docs?page=1",
+			allowed: true,
+		},
+		{
+			name:    "host followed by another domain",
+			policy:  remotePolicy{allow: []string{"https://example.com"}},
+			url:     "https://example.com.evil.org/x",
+			allowed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.check(tt.url)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrRemoteNotAllowed)
+			}
+		})
+	}
+}
+
+func TestREADMEIsStable(t *testing.T) {
+	// The README documents the directives with examples in code blocks, which must be left as they are.
+	sourceMD := V(os.ReadFile("README.md"))
+	output := bytes.NewBuffer(nil)
+	V0(Process(sourceMD, output, nil))
+	if !bytes.Equal(sourceMD, output.Bytes()) {
+		t.Fatalf(`Unmatched:\n\n%s`, diff.LineDiff(string(sourceMD), output.String()))
+	}
+}
+
+func TestIncludeParameters(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		expected   string
+		diagnostic string
+	}{
+		{
+			name: "all placeholders defined",
+			input: `<!-- +INCLUDE: testdata/install_snippet.md tool=mdpp version=1.2 -->
+<!-- +END -->
+`,
+			expected: `<!-- +INCLUDE: testdata/install_snippet.md tool=mdpp version=1.2 -->
+Install mdpp 1.2:
+
+    go install github.com/knaka/mdpp@v1.2
+
+Placeholders are written as ` + "`{{name}}`" + `.
+<!-- +END -->
+`,
+		},
+		{
+			name: "undefined placeholder and quoted value",
+			input: `<!-- +INCLUDE: testdata/install_snippet.md tool="mdpp cli" -->
+<!-- +END -->
+`,
+			expected: `<!-- +INCLUDE: testdata/install_snippet.md tool="mdpp cli" -->
+Install mdpp cli {{ version }}:
+
+    go install github.com/knaka/mdpp cli@v{{version}}
+
+Placeholders are written as ` + "`{{name}}`" + `.
+<!-- +END -->
+`,
+			diagnostic: "undefined placeholder {{version}}",
+		},
+		{
+			name: "no parameters",
+			input: `<!-- +INCLUDE: testdata/install_snippet.md -->
+<!-- +END -->
+`,
+			expected: `<!-- +INCLUDE: testdata/install_snippet.md -->
+Install {{tool}} {{ version }}:
+
+    go install github.com/knaka/{{tool}}@v{{version}}
+
+Placeholders are written as ` + "`\\{{name}}`" + `.
+<!-- +END -->
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := bytes.NewBuffer(nil)
+			diagnostics := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output, nil, WithDiagnosticOutput(diagnostics)))
+			if tt.expected != output.String() {
+				t.Fatalf(`Unmatched:\n\n%s`, diff.LineDiff(tt.expected, output.String()))
+			}
+			if tt.diagnostic == "" {
+				assert.Empty(t, diagnostics.String())
+			} else {
+				assert.Contains(t, diagnostics.String(), tt.diagnostic)
+			}
+		})
+	}
+}
+
+func TestCodeOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:  "dedent, expand tabs and trim in fenced code block",
+			input: "```go\n```\n\n<!-- +CODE: testdata/method_body.go dedent tabs=4 trim -->\n",
+			expected: "```go\n" +
+				"func (g *Greeter) Greet(name string) string {\n" +
+				"    if name == \"\" {\n" +
+				"        name = \"world\"\n" +
+				"    }\n" +
+				"    return \"Hello, \" + name\n" +
+				"}\n" +
+				"```\n\n<!-- +CODE: testdata/method_body.go dedent tabs=4 trim -->\n",
+		},
+		{
+			name:  "same options in indented code block",
+			input: "    foo\n\n<!-- +CODE: testdata/method_body.go dedent tabs=4 trim -->\n",
+			expected: "    func (g *Greeter) Greet(name string) string {\n" +
+				"        if name == \"\" {\n" +
+				"            name = \"world\"\n" +
+				"        }\n" +
+				"        return \"Hello, \" + name\n" +
+				"    }\n" +
+				"\n<!-- +CODE: testdata/method_body.go dedent tabs=4 trim -->\n",
+		},
+		{
+			name:  "dedent keeps tabs and maxlines elides the rest",
+			input: "```go\n```\n\n<!-- +CODE: testdata/method_body.go trim dedent maxlines=3 -->\n",
+			expected: "```go\n" +
+				"func (g *Greeter) Greet(name string) string {\n" +
+				"\tif name == \"\" {\n" +
+				"…\n" +
+				"```\n\n<!-- +CODE: testdata/method_body.go trim dedent maxlines=3 -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output, nil))
+			if tt.expected != output.String() {
+				t.Fatalf(`Unmatched:\n\n%s`, diff.LineDiff(tt.expected, output.String()))
+			}
+		})
+	}
+}
+
+func TestCodeFenceLengthening(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:  "lengthen backtick fences",
+			input: "- Sample:\n\n  ```markdown\n  ```\n\n  <!-- +CODE: testdata/fenced_sample.md -->\n",
+			expected: "- Sample:\n\n  ````markdown\n" +
+				"  # Sample\n  \n  ```sh\n  echo hello\n  ```\n" +
+				"  ````\n\n  <!-- +CODE: testdata/fenced_sample.md -->\n",
+		},
+		{
+			name:  "tilde fences do not collide with backticks",
+			input: "~~~markdown\nfoo\n~~~\n\n<!-- +CODE: testdata/fenced_sample.md -->\n",
+			expected: "~~~markdown\n" +
+				"# Sample\n\n```sh\necho hello\n```\n" +
+				"~~~\n\n<!-- +CODE: testdata/fenced_sample.md -->\n",
+		},
+		{
+			name:  "longer fences are kept",
+			input: "`````\n`````\n\n<!-- +CODE: testdata/fenced_sample.md -->\n",
+			expected: "`````\n" +
+				"# Sample\n\n```sh\necho hello\n```\n" +
+				"`````\n\n<!-- +CODE: testdata/fenced_sample.md -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestCodeLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		config   *Config
+	}{
+		{
+			name:     "from extension",
+			input:    "```\n```\n<!-- +CODE: testdata/hello.c lang -->\n",
+			expected: "```c\n" + helloC + "```\n<!-- +CODE: testdata/hello.c lang -->\n",
+		},
+		{
+			name:     "from file name, preserving attributes",
+			input:    "```text {linenos=true}\n```\n<!-- +CODE: testdata/Dockerfile lang -->\n",
+			expected: "```dockerfile {linenos=true}\nFROM golang:1.24\n```\n<!-- +CODE: testdata/Dockerfile lang -->\n",
+		},
+		{
+			name:     "from shebang, before attributes only",
+			input:    "~~~ {hl_lines=\"2\"}\n~~~\n<!-- +CODE: testdata/greet lang -->\n",
+			expected: "~~~ bash {hl_lines=\"2\"}\n#!/usr/bin/env bash\necho \"Hello!\"\n~~~\n<!-- +CODE: testdata/greet lang -->\n",
+		},
+		{
+			name:     "explicit language",
+			input:    "```c\n```\n<!-- +CODE: testdata/greet lang=shell -->\n",
+			expected: "```shell\n#!/usr/bin/env bash\necho \"Hello!\"\n```\n<!-- +CODE: testdata/greet lang=shell -->\n",
+		},
+		{
+			name:     "configuration default and override",
+			input:    "```\n```\n<!-- +CODE: testdata/hello.c -->\n",
+			expected: "```c99\n" + helloC + "```\n<!-- +CODE: testdata/hello.c -->\n",
+			config:   V(LoadConfig("testdata/config.yaml")),
+		},
+		{
+			name:     "disabled in directive",
+			input:    "```\n```\n<!-- +CODE: testdata/hello.c lang=none -->\n",
+			expected: "```\n" + helloC + "```\n<!-- +CODE: testdata/hello.c lang=none -->\n",
+			config:   V(LoadConfig("testdata/config.yaml")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output, nil, WithConfig(tt.config)))
+			if tt.expected != output.String() {
+				t.Fatalf(`Unmatched:\n\n%s`, diff.LineDiff(tt.expected, output.String()))
+			}
+		})
+	}
+}
+
+func TestCodeBlockCreation(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "bare directive",
+			input:    "Code:\n\n<!-- +CODE: testdata/hello.c -->\n",
+			expected: "Code:\n\n```c\n" + helloC + "```\n\n<!-- +CODE: testdata/hello.c -->\n",
+		},
+		{
+			name:  "in blockquote without language",
+			input: "> Code:\n>\n> <!-- +CODE: testdata/fenced_sample.md lang=none -->\n",
+			expected: "> Code:\n>\n> ````\n" +
+				"> # Sample\n> \n> ```sh\n> echo hello\n> ```\n" +
+				"> ````\n>\n> <!-- +CODE: testdata/fenced_sample.md lang=none -->\n",
+		},
+		{
+			name:  "on list item line",
+			input: "- <!-- +CODE: testdata/greet -->\n",
+			expected: "- ```bash\n" +
+				"  #!/usr/bin/env bash\n  echo \"Hello!\"\n" +
+				"  ```\n\n  <!-- +CODE: testdata/greet -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestGoExample(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:  "body into existing block",
+			input: "```go\nold\n```\n\n<!-- +GOEXAMPLE: testdata/goexample ExampleGreet -->\n",
+			expected: "```go\n" +
+				"// Greet in upper case\nname := \"world\"\nfmt.Println(\"Hello, \" + strings.ToUpper(name) + \"!\")\n" +
+				"```\n\n<!-- +GOEXAMPLE: testdata/goexample ExampleGreet -->\n",
+		},
+		{
+			name:  "body and output into new blocks",
+			input: "<!-- +GOEXAMPLE: testdata/goexample Greet output -->\n",
+			expected: "```go\n" +
+				"// Greet in upper case\nname := \"world\"\nfmt.Println(\"Hello, \" + strings.ToUpper(name) + \"!\")\n" +
+				"```\n\n```text\nHello, WORLD!\n```\n\n<!-- +GOEXAMPLE: testdata/goexample Greet output -->\n",
+		},
+		{
+			name:  "body and output into existing blocks",
+			input: "```go\n```\n\n```\nold\n```\n<!-- +GOEXAMPLE: testdata/goexample ExampleGreet output -->\n",
+			expected: "```go\n" +
+				"// Greet in upper case\nname := \"world\"\nfmt.Println(\"Hello, \" + strings.ToUpper(name) + \"!\")\n" +
+				"```\n\n```\nHello, WORLD!\n```\n<!-- +GOEXAMPLE: testdata/goexample ExampleGreet output -->\n",
+		},
+		{
+			name:  "output in an ordinary comment",
+			input: "<!-- +GOEXAMPLE: testdata/goexample Greet_sorted output -->\n",
+			expected: "```go\n" +
+				"names := []string{\"b\", \"a\"}\n// Sort so that the output: is stable\nsort.Strings(names)\nfmt.Println(names)\n" +
+				"```\n\n```text\n[a b]\n```\n\n<!-- +GOEXAMPLE: testdata/goexample Greet_sorted output -->\n",
+		},
+		{
+			name:  "whole-file example as runnable program",
+			input: "```go\n```\n<!-- +GOEXAMPLE: testdata/goexample_whole ExampleGreeter -->\n",
+			expected: "```go\n" +
+				"package main\n\nimport \"fmt\"\n\ntype greeter struct {\n\tname string\n}\n\n" +
+				"func (g greeter) greet() string {\n\treturn \"Hello, \" + g.name\n}\n\n" +
+				"func main() {\n\tfmt.Println(greeter{\"gopher\"}.greet())\n}\n" +
+				"```\n<!-- +GOEXAMPLE: testdata/goexample_whole ExampleGreeter -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestGoAPI(t *testing.T) {
+	apiRows := "| `DefaultName` | `const DefaultName = \"world\"` | DefaultName is the name used when no name is given. |\n" +
+		"| `Pattern` | `` const Pattern = `^(Hello\\|HELLO), .+[.!]$` `` | Pattern matches the greetings. |\n" +
+		"| `Decorate` | `var Decorate = func(greeting string) string { ... }` | Decorate decorates the greeting. |\n" +
+		"| `Join` | `func Join(names []string, sep string) string` | Join joins the names with \"\\|\" or the separator. |\n" +
+		"| `Greeter` | `type Greeter struct{ ... }` | Greeter builds greeting messages. |\n" +
+		"| `NewGreeter` | `func NewGreeter(style Style) *Greeter` | NewGreeter returns a greeter with the style. |\n" +
+		"| `Greeter.Greet` | `func (g *Greeter) Greet(name string) string` | Greet returns the greeting for the name. |\n" +
+		"| `Style` | `type Style int` | Style is a style of greetings. |\n" +
+		"| `Plain` | `const Plain Style = iota` | Plain greets without decoration. |\n" +
+		"| `Shout` | `const Shout` | Styles of greetings. |\n"
+	// The rows are easier to read without padding
+	compact := &Config{Table: TableConfig{Compact: true}}
+	tests := []struct {
+		name       string
+		input      string
+		expected   string
+		diagnostic string
+	}{
+		{
+			name:     "header-only table",
+			input:    "| Name | Signature | Description |\n| --- | --- | --- |\n<!-- +GOAPI: testdata/goapi -->\n",
+			expected: "| Name | Signature | Description |\n| --- | --- | --- |\n" + apiRows + "<!-- +GOAPI: testdata/goapi -->\n",
+		},
+		{
+			name:     "outdated table",
+			input:    "| Name | Signature | Description |\n| :--- | :--- | :--- |\n| `Old` | `func Old()` | Removed. |\n<!-- +GOAPI: testdata/goapi -->\n",
+			expected: "| Name | Signature | Description |\n| :--- | :--- | :--- |\n" + apiRows + "<!-- +GOAPI: testdata/goapi -->\n",
+		},
+		{
+			name:       "missing package keeps the table",
+			input:      "| Name |\n| --- |\n| `Old` |\n<!-- +GOAPI: testdata/nonexistent -->\n",
+			expected:   "| Name |\n| --- |\n| `Old` |\n<!-- +GOAPI: testdata/nonexistent -->\n",
+			diagnostic: "GOAPI testdata/nonexistent:",
+		},
+		{
+			name:       "no table before the directive",
+			input:      "Text.\n\n<!-- +GOAPI: testdata/goapi -->\n",
+			expected:   "Text.\n\n<!-- +GOAPI: testdata/goapi -->\n",
+			diagnostic: "GOAPI testdata/goapi: no table before the directive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			diagnostics := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil, WithConfig(compact), WithDiagnosticOutput(diagnostics)))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			if tt.diagnostic == "" {
+				assert.Empty(t, diagnostics.String())
+			} else {
+				assert.Contains(t, diagnostics.String(), tt.diagnostic)
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil, WithConfig(compact)))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestCodeDiff(t *testing.T) {
+	diffBody := "@@ -1,7 +1,9 @@\n" +
+		" package greet\n \n+import \"fmt\"\n+\n" +
+		" func Greet(name string) string {\n-\treturn \"Hello, \" + name\n+\treturn fmt.Sprintf(\"Hello, %s!\", name)\n }\n \n" +
+		" func Bye() string {\n"
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:  "new diff block",
+			input: "<!-- +CODEDIFF: testdata/greet_old.go testdata/greet_new.go -->\n",
+			expected: "```diff\n--- testdata/greet_old.go\n+++ testdata/greet_new.go\n" + diffBody +
+				"```\n\n<!-- +CODEDIFF: testdata/greet_old.go testdata/greet_new.go -->\n",
+		},
+		{
+			name:  "existing block with context option",
+			input: "```patch\nold\n```\n<!-- +CODEDIFF: testdata/greet_old.go testdata/greet_new.go context=0 -->\n",
+			expected: "```patch\n--- testdata/greet_old.go\n+++ testdata/greet_new.go\n" +
+				"@@ -2,0 +3,2 @@\n+import \"fmt\"\n+\n@@ -4 +6 @@\n-\treturn \"Hello, \" + name\n+\treturn fmt.Sprintf(\"Hello, %s!\", name)\n" +
+				"```\n<!-- +CODEDIFF: testdata/greet_old.go testdata/greet_new.go context=0 -->\n",
+		},
+		{
+			name:     "identical files",
+			input:    "```diff\nold\n```\n<!-- +CODEDIFF: testdata/greet_old.go testdata/greet_old.go -->\n",
+			expected: "```diff\n```\n<!-- +CODEDIFF: testdata/greet_old.go testdata/greet_old.go -->\n",
+		},
+		{
+			name:     "missing file",
+			input:    "```diff\nold\n```\n<!-- +CODEDIFF: testdata/greet_old.go testdata/nonexistent.go -->\n",
+			expected: "```diff\nold\n```\n<!-- +CODEDIFF: testdata/greet_old.go testdata/nonexistent.go -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestCodeHighlight(t *testing.T) {
+	code := "func handler(w http.ResponseWriter, r *http.Request) {\n" +
+		"\tname := r.URL.Query().Get(\"name\")\n\tif name == \"\" {\n\t\tname = \"world\"\n\t}\n" +
+		"\tfmt.Fprintf(w, \"Hello, %s!\", name)\n}\n"
+	// Markers are kept unless the hl option is given without a pattern
+	codeWithMarkers := string(V(os.ReadFile("testdata/highlight.go")))[1:]
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "markers with original line numbers",
+			input:    "```go\n```\n<!-- +CODE: testdata/highlight.go hl trim linenostart -->\n",
+			expected: "```go {hl_lines=\"2 4\" linenostart=2}\n" + code + "```\n<!-- +CODE: testdata/highlight.go hl trim linenostart -->\n",
+		},
+		{
+			name:     "regex updates existing attributes",
+			input:    "```go {linenos=table,hl_lines=[1]}\n```\n<!-- +CODE: testdata/highlight.go hl=name trim -->\n",
+			expected: "```go {linenos=table,hl_lines=\"2-4 6\"}\n" + codeWithMarkers + "```\n<!-- +CODE: testdata/highlight.go hl=name trim -->\n",
+		},
+		{
+			name:     "no highlighted lines removes the attribute",
+			input:    "```go {hl_lines=\"1\"}\n```\n<!-- +CODE: testdata/highlight.go hl=nothing trim -->\n",
+			expected: "```go\n" + codeWithMarkers + "```\n<!-- +CODE: testdata/highlight.go hl=nothing trim -->\n",
+		},
+		{
+			name:  "new code block",
+			input: "<!-- +CODE: testdata/highlight.go hl=Fprintf lang trim -->\n",
+			expected: "```go {hl_lines=\"6\"}\n" + codeWithMarkers +
+				"```\n\n<!-- +CODE: testdata/highlight.go hl=Fprintf lang trim -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		expected   string
+		config     *Config
+		diagnostic string
+	}{
+		{
+			name:  "hide markers only",
+			input: "```go\n```\n<!-- +CODE: testdata/client.go hide -->\n",
+			expected: "```go\nfunc newClient() *Client {\n\treturn &Client{\n" +
+				"\t\tURL: \"https://api-7.corp.example.com/v1\", // Internal endpoint\n\t\tKey: os.Getenv(\"API_TOKEN\"),\n\t}\n}\n" +
+				"```\n<!-- +CODE: testdata/client.go hide -->\n",
+		},
+		{
+			name:  "markers without the hide option",
+			input: "```go\n```\n<!-- +CODE: testdata/client.go drop=Key -->\n",
+			expected: "```go\nfunc newClient() *Client {\n\t// mdpp:hide\n\tsetupTracing()\n\t// mdpp:show\n\treturn &Client{\n" +
+				"\t\tURL: \"https://api-7.corp.example.com/v1\", // Internal endpoint\n\t}\n}\n" +
+				"```\n<!-- +CODE: testdata/client.go drop=Key -->\n",
+		},
+		{
+			name:  "unclosed hide",
+			input: "```go\n```\n<!-- +CODE: testdata/unclosed_hide.go hide -->\n",
+			expected: "```go\nfunc hidden() {\n\t// Lines between mdpp:hide and mdpp:show markers are hidden\n" +
+				"```\n<!-- +CODE: testdata/unclosed_hide.go hide -->\n",
+			diagnostic: "mdpp:hide without mdpp:show",
+		},
+		{
+			name:       "empty drop pattern",
+			input:      "```go\nold\n```\n<!-- +CODE: testdata/client.go drop= -->\n",
+			expected:   "```go\nold\n```\n<!-- +CODE: testdata/client.go drop= -->\n",
+			diagnostic: "drop requires a pattern",
+		},
+		{
+			name:     "rule without replace, drop or hide",
+			input:    "```go\nold\n```\n<!-- +CODE: testdata/client.go filter=typo -->\n",
+			expected: "```go\nold\n```\n<!-- +CODE: testdata/client.go filter=typo -->\n",
+			config: &Config{Filters: map[string][]FilterRule{
+				"typo": {{Replace: "/a/b/"}, {}},
+			}},
+			diagnostic: "filter typo: a rule requires exactly one of replace, drop or hide",
+		},
+		{
+			name:  "replace and drop in directive",
+			input: "```go\n```\n<!-- +CODE: testdata/client.go hide replace='/ *\\/\\/ internal.*$//i' replace=|corp\\.example\\.com|example.org| drop=TOKEN -->\n",
+			expected: "```go\nfunc newClient() *Client {\n\treturn &Client{\n" +
+				"\t\tURL: \"https://api-7.example.org/v1\",\n\t}\n}\n" +
+				"```\n<!-- +CODE: testdata/client.go hide replace='/ *\\/\\/ internal.*$//i' replace=|corp\\.example\\.com|example.org| drop=TOKEN -->\n",
+		},
+		{
+			name:  "named filter with line numbers",
+			input: "```go\n```\n<!-- +CODE: testdata/client.go filter=redact hl=URL linenostart -->\n",
+			expected: "```go {hl_lines=\"3\" linenostart=1}\nfunc newClient() *Client {\n\treturn &Client{\n" +
+				"\t\tURL: \"https://host.example.com/v1\", // Internal endpoint\n\t}\n}\n" +
+				"```\n<!-- +CODE: testdata/client.go filter=redact hl=URL linenostart -->\n",
+			config: V(LoadConfig("testdata/config.yaml")),
+		},
+		{
+			name:       "undefined filter keeps the code block",
+			input:      "```go\nold\n```\n<!-- +CODE: testdata/client.go filter=unknown -->\n",
+			expected:   "```go\nold\n```\n<!-- +CODE: testdata/client.go filter=unknown -->\n",
+			diagnostic: "undefined filter: unknown",
+		},
+		{
+			name:  "include with filters and parameters",
+			input: "<!-- +INCLUDE: testdata/internal_notes.md filter=redact owner=ops -->\n<!-- +END -->\n",
+			expected: "<!-- +INCLUDE: testdata/internal_notes.md filter=redact owner=ops -->\n" +
+				"Connect to host.example.com.\nUse the read replica.\n<!-- +END -->\n",
+			config: V(LoadConfig("testdata/config.yaml")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			diagnostics := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil, WithConfig(tt.config), WithDiagnosticOutput(diagnostics)))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			if tt.diagnostic == "" {
+				assert.Empty(t, diagnostics.String())
+			} else {
+				assert.Contains(t, diagnostics.String(), tt.diagnostic)
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil, WithConfig(tt.config)))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "JSON",
+			input:    "Version `0.0.0`<!-- +VALUE: testdata/values/package.json .version --> is out.\n",
+			expected: "Version `1.2.0`<!-- +VALUE: testdata/values/package.json .version --> is out.\n",
+		},
+		{
+			name:     "JSON key with special characters",
+			input:    "Types `x`<!-- +VALUE: testdata/values/package.json .dependencies[\"@types/node\"] -->\n",
+			expected: "Types `^22.1.0`<!-- +VALUE: testdata/values/package.json .dependencies[\"@types/node\"] -->\n",
+		},
+		{
+			name:     "JSON array as compact JSON",
+			input:    "Files: ``x``<!-- +VALUE: testdata/values/package.json .files -->\n",
+			expected: "Files: `[\"dist\",\"README.md\"]`<!-- +VALUE: testdata/values/package.json .files -->\n",
+		},
+		{
+			name:     "YAML in a list item",
+			input:    "- Contact `x`<!-- +VALUE: testdata/values/Chart.yaml .maintainers[0].email -->\n",
+			expected: "- Contact `ops@example.com`<!-- +VALUE: testdata/values/Chart.yaml .maintainers[0].email -->\n",
+		},
+		{
+			name:     "TOML",
+			input:    "Port `x`<!-- +VALUE: testdata/values/config.toml .server.port --> of `x`<!-- +VALUE: testdata/values/config.toml .backends[0].name -->\n",
+			expected: "Port `8080`<!-- +VALUE: testdata/values/config.toml .server.port --> of `primary`<!-- +VALUE: testdata/values/config.toml .backends[0].name -->\n",
+		},
+		{
+			name:     "go.mod",
+			input:    "Go `x`<!-- +VALUE: testdata/values/web.mod .go --> with goldmark `x`<!-- +VALUE: testdata/values/web.mod .require[github.com/yuin/goldmark] -->\n",
+			expected: "Go `1.24.0`<!-- +VALUE: testdata/values/web.mod .go --> with goldmark `v1.7.8`<!-- +VALUE: testdata/values/web.mod .require[github.com/yuin/goldmark] -->\n",
+		},
+		{
+			name:     "missing key keeps the code span",
+			input:    "Version `0.0.0`<!-- +VALUE: testdata/values/package.json .release -->\n",
+			expected: "Version `0.0.0`<!-- +VALUE: testdata/values/package.json .release -->\n",
+		},
+		{
+			name:     "empty string as a space",
+			input:    "Icon `x`<!-- +VALUE: testdata/values/Chart.yaml .icon -->\n",
+			expected: "Icon ` `<!-- +VALUE: testdata/values/Chart.yaml .icon -->\n",
+		},
+		{
+			name:     "multi-line string in a single line",
+			input:    "About `x`<!-- +VALUE: testdata/values/Chart.yaml .description -->\n",
+			expected: "About ``A web server with `ops` tools``<!-- +VALUE: testdata/values/Chart.yaml .description -->\n",
+		},
+		{
+			name:     "not after a code span",
+			input:    "Version 0.0.0<!-- +VALUE: testdata/values/package.json .version -->\n",
+			expected: "Version 0.0.0<!-- +VALUE: testdata/values/package.json .version -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestTableFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		config   *Config
+	}{
+		{
+			name: "East Asian wide characters and alignments",
+			input: "| 品目 | Price | Note |\n| :--- | ---: | :---: |\n| りんご | 100 | x |\n| Banana | 80 | 国産 |\n" +
+				"<!-- +TBLFM: @2$2=@2$2 -->\n",
+			expected: "| 品目   | Price | Note  |\n| :----- | ----: | :---: |\n| りんご |   100 |   x   |\n| Banana |    80 | 国産  |\n" +
+				"<!-- +TBLFM: @2$2=@2$2 -->\n",
+		},
+		{
+			name:     "compact",
+			input:    "| Item | Price |\n| :------ | ------: |\n| Apple  |    100 |\n<!-- +TBLFM: @2$2=@2$2 -->\n",
+			expected: "| Item | Price |\n| :--- | ---: |\n| Apple | 100 |\n<!-- +TBLFM: @2$2=@2$2 -->\n",
+			config:   &Config{Table: TableConfig{Compact: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil, WithConfig(tt.config)))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil, WithConfig(tt.config)))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestTableCells(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "escaped pipes and inline formatting",
+			input:    "| Syntax | Example |\n| --- | --- |\n| `a \\| b` | **x** \\| [link](https://example.com) |\n<!-- +TBLFM: @2$2=@2$2 -->\n",
+			expected: "| Syntax   | Example                              |\n| -------- | ------------------------------------ |\n| `a \\| b` | **x** \\| [link](https://example.com) |\n<!-- +TBLFM: @2$2=@2$2 -->\n",
+		},
+		{
+			name:     "pipes and newlines in included values",
+			input:    "| A |\n| --- |\n| x |\n<!-- +TABLE_INCLUDE: testdata/special_cells.csv -->\n",
+			expected: "| Operator | Example         |\n| -------- | --------------- |\n| Or       | a \\| b          |\n| Lines    | first<br>second |\n<!-- +TABLE_INCLUDE: testdata/special_cells.csv -->\n",
+		},
+		{
+			name:     "pipes and line breaks through Miller",
+			input:    "| Name | Note |\n| --- | --- |\n| a\\|b | one<br>two |\n<!-- +MILLER: $Len = strlen($Name) -->\n",
+			expected: "| Name | Note       | Len |\n| ---- | ---------- | --- |\n| a\\|b | one<br>two | 3   |\n<!-- +MILLER: $Len = strlen($Name) -->\n",
+		},
+		{
+			name:     "tabs and backslashes through Miller",
+			input:    "| Path | Len |\n| --- | --- |\n| C:\\temp\tx | 0 |\n<!-- +MILLER: $Len = strlen($Path) -->\n",
+			expected: "| Path      | Len |\n| --------- | --- |\n| C:\\temp\tx | 9   |\n<!-- +MILLER: $Len = strlen($Path) -->\n",
+		},
+		{
+			name:     "short rows",
+			input:    "| A | B |\n| --- | --- |\n| 1 |\n<!-- +TBLFM: @2$2=@2$1 -->\n",
+			expected: "| A   | B   |\n| --- | --- |\n| 1   | 1   |\n<!-- +TBLFM: @2$2=@2$1 -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+}
+
+func TestSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "query a database",
+			input:    "| Old |\n| --- |\n| x |\n<!-- +SQL: testdata/results.db SELECT benchmark, ns_per_op, allocs, note FROM results ORDER BY ns_per_op -->\n",
+			expected: "| benchmark | ns_per_op | allocs | note |\n| --------- | --------- | ------ | ---- |\n| Walk      | 95.25     | 0      | fast |\n| Render    | 830       | 4      | a\\|b |\n| Parse     | 1520.5    | 12     |      |\n<!-- +SQL: testdata/results.db SELECT benchmark, ns_per_op, allocs, note FROM results ORDER BY ns_per_op -->\n",
+		},
+		{
+			name:  "multi-line query over a CSV file",
+			input: "| Old |\n| --- |\n| x |\n<!-- +SQL: table:sales=testdata/sales.csv\n  SELECT region, sum(amount) AS total\n  FROM sales GROUP BY region ORDER BY total DESC\n-->\n",
+			expected: "| region | total |\n| ------ | ----- |\n| West   | 259   |\n| East   | 140   |\n" +
+				"<!-- +SQL: table:sales=testdata/sales.csv\n  SELECT region, sum(amount) AS total\n  FROM sales GROUP BY region ORDER BY total DESC\n-->\n",
+		},
+		{
+			name:     "join a database and a CSV file",
+			input:    "| Old |\n| --- |\n| x |\n<!-- +SQL: testdata/results.db table:sales=testdata/sales.csv SELECT count(*) AS n FROM results, sales WHERE amount > 50 -->\n",
+			expected: "| n   |\n| --- |\n| 6   |\n<!-- +SQL: testdata/results.db table:sales=testdata/sales.csv SELECT count(*) AS n FROM results, sales WHERE amount > 50 -->\n",
+		},
+		{
+			name:     "numbers only if written back as the same text",
+			input:    "| Old |\n| --- |\n| x |\n<!-- +SQL: table:codes=testdata/codes.csv SELECT code, typeof(code) AS t1, amount, typeof(amount) AS t2 FROM codes -->\n",
+			expected: "| code | t1      | amount | t2   |\n| ---- | ------- | ------ | ---- |\n| 007  | text    | 1e3    | text |\n| 10   | integer | 2.5    | real |\n| -3   | integer | 0.10   | text |\n<!-- +SQL: table:codes=testdata/codes.csv SELECT code, typeof(code) AS t1, amount, typeof(amount) AS t2 FROM codes -->\n",
+		},
+		{
+			name:     "database is not modified",
+			input:    "| Old |\n| --- |\n| x   |\n<!-- +SQL: testdata/results.db DELETE FROM results RETURNING * -->\n",
+			expected: "| Old |\n| --- |\n| x   |\n<!-- +SQL: testdata/results.db DELETE FROM results RETURNING * -->\n",
+		},
+		{
+			name:     "missing database",
+			input:    "| Old |\n| --- |\n| x   |\n<!-- +SQL: testdata/missing.db SELECT 1 -->\n",
+			expected: "| Old |\n| --- |\n| x   |\n<!-- +SQL: testdata/missing.db SELECT 1 -->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output1 := bytes.NewBuffer(nil)
+			V0(Process([]byte(tt.input), output1, nil))
+			if tt.expected != output1.String() {
+				t.Fatalf(`Unmatched on first run:\n\n%s`, diff.LineDiff(tt.expected, output1.String()))
+			}
+			output2 := bytes.NewBuffer(nil)
+			V0(Process(output1.Bytes(), output2, nil))
+			if output1.String() != output2.String() {
+				t.Fatalf(`Process is not idempotent:\n\n%s`, diff.LineDiff(output1.String(), output2.String()))
+			}
+		})
+	}
+	// The query must not have deleted the rows
+	output := bytes.NewBuffer(nil)
+	V0(Process([]byte("| n |\n| --- |\n| 0 |\n<!-- +SQL: testdata/results.db SELECT count(*) AS n FROM results -->\n"), output, nil))
+	assert.Contains(t, output.String(), "| 3   |")
+	// Database paths that look like query keywords or contain URI syntax
+	dbContent := V(os.ReadFile("testdata/results.db"))
+	for _, name := range []string{"select.db", "values.db", "a?b#c%41.db"} {
+		dbPath := filepath.Join(t.TempDir(), name)
+		V0(os.WriteFile(dbPath, dbContent, 0o644))
+		output := bytes.NewBuffer(nil)
+		V0(Process([]byte("| n |\n| --- |\n| 0 |\n<!-- +SQL: \""+dbPath+"\" SELECT count(*) AS n FROM results -->\n"), output, nil))
+		assert.Contains(t, output.String(), "| 3   |", name)
+	}
+}
+
+func TestTableExport(t *testing.T) {
+	dirPath := t.TempDir()
+	input := "| Item | Price | Qty | Total |\n| --- | ---: | ---: | ---: |\n| Apple \\| red | 100 | 2 | |\n| Pear | 80 | 3 | |\n" +
+		"<!-- +TBLFM: @2$4..@>$4=$2*$3 -->\n" +
+		"<!-- +TABLE_EXPORT: " + dirPath + "/items.csv -->\n" +
+		"<!-- +TABLE_EXPORT: " + dirPath + "/items.json -->\n" +
+		"<!-- +TABLE_EXPORT: " + dirPath + "/items.txt format=tsv -->\n"
+	output := bytes.NewBuffer(nil)
+	V0(Process([]byte(input), output, nil))
+	assert.Equal(t, "Item,Price,Qty,Total\nApple | red,100,2,200\nPear,80,3,240\n", string(V(os.ReadFile(dirPath+"/items.csv"))))
+	assert.Equal(t, `[
+  {
+    "Item": "Apple | red",
+    "Price": "100",
+    "Qty": "2",
+    "Total": "200"
+  },
+  {
+    "Item": "Pear",
+    "Price": "80",
+    "Qty": "3",
+    "Total": "240"
+  }
+]
+`, string(V(os.ReadFile(dirPath+"/items.json"))))
+	assert.Equal(t, "Item\tPrice\tQty\tTotal\nApple | red\t100\t2\t200\nPear\t80\t3\t240\n", string(V(os.ReadFile(dirPath+"/items.txt"))))
+
+	// The files are not rewritten if their contents do not change
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	V0(os.Chtimes(dirPath+"/items.csv", past, past))
+	V0(Process(output.Bytes(), bytes.NewBuffer(nil), nil))
+	assert.Equal(t, past, V(os.Stat(dirPath+"/items.csv")).ModTime().UTC())
+
+	// A table without a computing directive is exported as it is
+	V0(Process([]byte("| A | B |\n| --- | --- |\n| 1 | <br> |\n<!-- +TABLE_EXPORT: "+dirPath+"/plain.csv -->\n"), bytes.NewBuffer(nil), nil))
+	assert.Equal(t, "A,B\n1,\"\n\"\n", string(V(os.ReadFile(dirPath+"/plain.csv"))))
+}
+
+func TestExtractTables(t *testing.T) {
+	input := "# Title\n\n| A | B |\n| --- | --- |\n| 1 | |\n<!-- +TBLFM: @2$2=@2$1+1 -->\n\nText\n\n> | X |\n> | --- |\n> | `a\\|b` |\n"
+	tables := V(ExtractTables([]byte(input), nil))
+	assert.Equal(t, [][][]string{
+		{{"A", "B"}, {"1", "2"}},
+		{{"X"}, {"`a|b`"}},
+	}, tables)
+}
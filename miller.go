@@ -0,0 +1,212 @@
+package mdpp
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/johnkerl/miller/v6/pkg/climain"
+	"github.com/johnkerl/miller/v6/pkg/mlrval"
+	"github.com/johnkerl/miller/v6/pkg/transformers"
+	"github.com/johnkerl/miller/v6/pkg/types"
+)
+
+// millerDSLKeywords are the keywords that start statements of the Miller DSL and are also names of verbs. Scripts starting with them are put expressions, and the verbs can be used in chains that start with "then".
+var millerDSLKeywords = map[string]bool{
+	"filter": true,
+	"tee":    true,
+}
+
+// millerArgs returns the command line of Miller for the script of a Miller directive. A script that starts with "then" or with a verb such as "sort" is a chain of verbs joined by "then", and any other script is the expression of the "put" verb.
+//
+// Unknown verbs, a "then" without a verb and the help options are reported as errors beforehand, as Miller would print the usage for them instead of a table.
+func millerArgs(script string) (args []string, err error) {
+	words := strings.Fields(script)
+	if len(words) == 0 || words[0] != "then" && (transformers.LookUp(words[0]) == nil || millerDSLKeywords[words[0]]) {
+		return []string{"mlr", "put", "-e", script}, nil
+	}
+	tokens, err := splitDirectiveArgs(script)
+	if err != nil {
+		return
+	}
+	for i, token := range tokens {
+		if token == "-h" || token == "--help" {
+			return nil, fmt.Errorf("help option is not available: %s", script)
+		}
+		if i > 0 && token != "then" {
+			continue
+		}
+		verbIndex := i
+		if token == "then" {
+			verbIndex++
+		}
+		if verbIndex >= len(tokens) {
+			return nil, fmt.Errorf("then requires a verb: %s", script)
+		}
+		if transformers.LookUp(tokens[verbIndex]) == nil {
+			return nil, fmt.Errorf("verb not found: %s", tokens[verbIndex])
+		}
+	}
+	return append([]string{"mlr"}, tokens...), nil
+}
+
+// millerChildEnv is the environment variable that makes the executable run as the child process of runMiller.
+const millerChildEnv = "MDPP_MILLER_CHILD"
+
+// millerRequest is the input of the child process of runMiller.
+type millerRequest struct {
+	Rows   [][]string `json:"rows"`
+	Script string     `json:"script"`
+}
+
+func init() {
+	if os.Getenv(millerChildEnv) != "1" {
+		return
+	}
+	// The child runs Miller before the main function of the host starts
+	if err := serveMiller(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// serveMiller reads a request from the reader, runs it and writes the rows of the result to the writer.
+func serveMiller(reader io.Reader, writer io.Writer) (err error) {
+	var request millerRequest
+	if err = json.NewDecoder(reader).Decode(&request); err != nil {
+		return
+	}
+	resultData, err := transformMillerRecords(request.Rows, request.Script)
+	if err != nil {
+		return
+	}
+	return json.NewEncoder(writer).Encode(resultData)
+}
+
+// runMiller runs the Miller script on the rows of a table, whose first row is the header, and returns the rows of the result.
+//
+// Miller exits the process on invalid options and expressions, so it runs in a child process of the current executable, which is told by millerChildEnv to serve the request from the standard input. The rows are passed through pipes, not files.
+func runMiller(tableData [][]string, script string) (resultData [][]string, err error) {
+	if _, err = millerArgs(script); err != nil {
+		return
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return
+	}
+	input, err := json.Marshal(millerRequest{Rows: tableData, Script: script})
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(executable)
+	cmd.Env = append(os.Environ(), millerChildEnv+"=1")
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		// The first line tells the reason, and the usage of the verb may follow it
+		message, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		// Miller prints only the usage of the verb for invalid options
+		if usage, found := strings.CutPrefix(message, "Usage: "); found {
+			return nil, fmt.Errorf("invalid options: %s", usage)
+		}
+		if message != "" {
+			return nil, errors.New(message)
+		}
+		return
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &resultData); err != nil {
+		return nil, fmt.Errorf("unexpected output of Miller: %s", strings.TrimSpace(stdout.String()))
+	}
+	return
+}
+
+// transformMillerRecords runs the Miller script on the rows of a table, whose first row is the header, and returns the rows of the result. The records are passed to and from the verbs in memory. The header of the result has the fields of all the records in the order they appear.
+//
+// Miller exits the process on invalid options of the verbs and on errors of put expressions, so this is called only in the child process of runMiller.
+func transformMillerRecords(tableData [][]string, script string) (resultData [][]string, err error) {
+	args, err := millerArgs(script)
+	if err != nil {
+		return
+	}
+	options, recordTransformers, err := climain.ParseCommandLine(args)
+	if err != nil {
+		return
+	}
+	// The arguments that the verbs do not take are the names of input files on the command line
+	if len(options.FileNames) > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(options.FileNames, " "))
+	}
+	context := types.NewContext()
+	records := list.New() // list of *types.RecordAndContext
+	if len(tableData) > 0 {
+		header := tableData[0]
+		for _, row := range tableData[1:] {
+			record := mlrval.NewMlrmapAsRecord()
+			for i, key := range header {
+				value := ""
+				if i < len(row) {
+					value = row[i]
+				}
+				if _, err = record.PutReferenceMaybeDedupe(key, mlrval.FromDeferredType(value), options.ReaderOptions.DedupeFieldNames); err != nil {
+					return
+				}
+			}
+			context.UpdateForInputRecord()
+			records.PushBack(types.NewRecordAndContext(record, context))
+		}
+	}
+	records.PushBack(types.NewEndOfStreamMarker(context))
+	readerChannel := make(chan *list.List, 1)
+	readerChannel <- records
+	// Verbs such as "head" signal that they ignore the rest of the input
+	readerDownstreamDoneChannel := make(chan bool, 1)
+	writerChannel := make(chan *list.List, 1)
+	transformers.ChainTransformer(readerChannel, readerDownstreamDoneChannel, recordTransformers, writerChannel, options)
+	var outputRecords []*mlrval.Mlrmap
+	var keys []string
+	keySet := map[string]bool{}
+	for done := false; !done; {
+		for element := (<-writerChannel).Front(); element != nil; element = element.Next() {
+			recordAndContext := element.Value.(*types.RecordAndContext)
+			if recordAndContext.EndOfStream {
+				done = true
+				break
+			}
+			// The strings of print statements are not part of the table
+			if recordAndContext.Record == nil {
+				continue
+			}
+			outputRecords = append(outputRecords, recordAndContext.Record)
+			for entry := recordAndContext.Record.Head; entry != nil; entry = entry.Next {
+				if !keySet[entry.Key] {
+					keySet[entry.Key] = true
+					keys = append(keys, entry.Key)
+				}
+			}
+		}
+	}
+	if len(outputRecords) == 0 {
+		// The columns of the table are kept when no records are left
+		return tableData[:min(len(tableData), 1)], nil
+	}
+	resultData = append(resultData, keys)
+	for _, record := range outputRecords {
+		row := make([]string, len(keys))
+		for i, key := range keys {
+			if value := record.Get(key); value != nil {
+				row[i] = value.String()
+			}
+		}
+		resultData = append(resultData, row)
+	}
+	return
+}
@@ -0,0 +1,36 @@
+package mdpp
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// regexpPlaceholder matches a `{{name}}` placeholder, optionally preceded by a backslash that escapes it.
+var regexpPlaceholder = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(\\?)\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+})
+
+const (
+	placeholderEscapeIndex = 1
+	placeholderNameIndex   = 2
+)
+
+// substitutePlaceholders replaces each `{{name}}` placeholder in the content with the value of the parameter of the same name. An escaped placeholder `\{{name}}` is replaced with the literal `{{name}}`. Placeholders without a parameter are left as they are, and their names are returned as undefined.
+func substitutePlaceholders(content string, values map[string]string) (result string, undefined []string) {
+	placeholderRegexp := regexpPlaceholder()
+	result = placeholderRegexp.ReplaceAllStringFunc(content, func(match string) string {
+		submatches := placeholderRegexp.FindStringSubmatch(match)
+		if submatches[placeholderEscapeIndex] != "" {
+			return strings.TrimPrefix(match, `\`)
+		}
+		name := submatches[placeholderNameIndex]
+		value, ok := values[name]
+		if !ok {
+			undefined = append(undefined, name)
+			return match
+		}
+		return value
+	})
+	return
+}
@@ -0,0 +1,76 @@
+package mdpp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ErrRemoteNotAllowed is returned when a remote URL is rejected by the allowlist or the denylist.
+var ErrRemoteNotAllowed = errors.New("remote URL not allowed")
+
+// maxRedirects is the maximum number of redirects followed when fetching a remote URL.
+const maxRedirects = 10
+
+// remotePolicy restricts the remote URLs that can be fetched.
+//
+// Each pattern is either a URL prefix such as "https://raw.githubusercontent.com/knaka/" (when it contains "://") or a hostname pattern such as "docs.example.com" or "*.example.com", in which "*" matches any sequence of characters. Denied patterns take precedence over allowed patterns, and an empty allowlist allows every URL that is not denied.
+type remotePolicy struct {
+	allow []string
+	deny  []string
+}
+
+// matchRemotePattern reports whether the URL matches the pattern. The scheme and the host of a URL prefix are compared case-insensitively, and its path matches the cleaned and unescaped path of the URL on segment boundaries, so that "https://example.com/docs" matches neither "https://example.com/docs-old" nor "https://example.com/docs/../private".
+func matchRemotePattern(u *url.URL, pattern string) bool {
+	if strings.Contains(pattern, "://") {
+		prefix, err := url.Parse(pattern)
+		if err != nil {
+			return false
+		}
+		if !strings.EqualFold(prefix.Scheme, u.Scheme) || !strings.EqualFold(prefix.Host, u.Host) {
+			return false
+		}
+		prefixPath := path.Clean("/" + prefix.Path)
+		urlPath := path.Clean("/" + u.Path)
+		return urlPath == prefixPath || strings.HasPrefix(urlPath, strings.TrimSuffix(prefixPath, "/")+"/")
+	}
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(u.Hostname()))
+	return err == nil && matched
+}
+
+// check returns an error wrapping ErrRemoteNotAllowed if the URL is not allowed by the policy.
+func (policy *remotePolicy) check(urlStr string) error {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range policy.deny {
+		if matchRemotePattern(u, pattern) {
+			return fmt.Errorf("%w: %s (denied by %q)", ErrRemoteNotAllowed, urlStr, pattern)
+		}
+	}
+	if len(policy.allow) == 0 {
+		return nil
+	}
+	for _, pattern := range policy.allow {
+		if matchRemotePattern(u, pattern) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s (not in the allowlist)", ErrRemoteNotAllowed, urlStr)
+}
+
+// httpClient returns an HTTP client that rejects redirects to URLs that the policy does not allow.
+func (policy *remotePolicy) httpClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return policy.check(req.URL.String())
+		},
+	}
+}
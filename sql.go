@@ -0,0 +1,226 @@
+package mdpp
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	gmast "github.com/yuin/goldmark/ast"
+
+	// Pure Go SQLite driver registered as "sqlite"
+	_ "modernc.org/sqlite"
+
+	//revive:disable-next-line:dot-imports
+	. "github.com/knaka/go-utils"
+)
+
+// sqlTableSource is a file that is loaded as a temporary table of a SQL query.
+type sqlTableSource struct {
+	name     string
+	filePath string
+}
+
+// regexpSQLArgToken matches a leading argument of the SQL directive, which is the database path or a table source.
+var regexpSQLArgToken = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^\s*("[^"]*"|'[^']*'|\S+)`)
+})
+
+// regexpSQLTableSource matches a table source such as "table:sales=data/sales.csv".
+var regexpSQLTableSource = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?i)^table:([A-Za-z_][A-Za-z0-9_]*)=(.+)$`)
+})
+
+// regexpSQLQueryStart matches the first word of a query. The keyword must be followed by the end of the word or "(", so that a path such as "select.db" is not a query.
+var regexpSQLQueryStart = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?i)^(\(|(SELECT|WITH|VALUES|PRAGMA|EXPLAIN)(\(|$))`)
+})
+
+// parseSQLArgs parses the arguments of the SQL directive, which are the optional database path and table sources followed by the query.
+func parseSQLArgs(text string) (dbPath string, sources []sqlTableSource, query string, err error) {
+	rest := text
+	for {
+		matches := regexpSQLArgToken().FindStringSubmatch(rest)
+		if matches == nil || regexpSQLQueryStart().MatchString(matches[1]) {
+			break
+		}
+		token := matches[1]
+		if unquoted, err := strconv.Unquote(token); err == nil {
+			token = unquoted
+		} else if strings.HasPrefix(token, "'") && strings.HasSuffix(token, "'") && len(token) >= 2 {
+			token = token[1 : len(token)-1]
+		}
+		if sourceMatches := regexpSQLTableSource().FindStringSubmatch(token); sourceMatches != nil {
+			sources = append(sources, sqlTableSource{name: sourceMatches[1], filePath: sourceMatches[2]})
+		} else if dbPath == "" && len(sources) == 0 {
+			dbPath = token
+		} else {
+			break
+		}
+		rest = rest[len(matches[0]):]
+	}
+	query = strings.TrimSpace(rest)
+	if query == "" {
+		err = fmt.Errorf("SQL requires a query: %s", text)
+	}
+	return
+}
+
+// quoteSQLIdentifier quotes an identifier such as a table or a column name.
+func quoteSQLIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqlCellValue converts the text of a cell into a value of SQLite, so that numbers are compared as numbers and empty cells are NULL. A number is stored only if it is written back as the same text, so that cells such as "007" and "1e3" are kept as they are.
+func sqlCellValue(cell string) any {
+	if cell == "" {
+		return nil
+	}
+	if n, err := strconv.ParseInt(cell, 10, 64); err == nil && strconv.FormatInt(n, 10) == cell {
+		return n
+	}
+	if f, err := strconv.ParseFloat(cell, 64); err == nil && formatSQLValue(f) == cell {
+		return f
+	}
+	return cell
+}
+
+// formatSQLValue formats a value of a result set as the text of a table cell.
+func formatSQLValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// createSQLTable loads the file of the source and creates a temporary table of its rows, whose first row is the header. The file is loaded with the default options of TABLE_INCLUDE, so that a CSV file is read as UTF-8 with commas.
+func createSQLTable(db *sql.DB, source sqlTableSource) (err error) {
+	tableData, err := loadTableFromFile(source.filePath, &tableLoadOptions{})
+	if err != nil {
+		return
+	}
+	if len(tableData) == 0 {
+		return fmt.Errorf("empty table: %s", source.filePath)
+	}
+	columns := make([]string, len(tableData[0]))
+	placeholders := make([]string, len(tableData[0]))
+	for i, name := range tableData[0] {
+		// Columns without types keep the values as they are inserted
+		columns[i] = quoteSQLIdentifier(name)
+		placeholders[i] = "?"
+	}
+	tableName := quoteSQLIdentifier(source.name)
+	if _, err = db.Exec(fmt.Sprintf("CREATE TEMP TABLE %s (%s)", tableName, strings.Join(columns, ", "))); err != nil {
+		return
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer (func() { Ignore(tx.Rollback()) })()
+	insert := fmt.Sprintf("INSERT INTO %s VALUES (%s)", tableName, strings.Join(placeholders, ", "))
+	for _, row := range tableData[1:] {
+		values := make([]any, len(columns))
+		for i := range values {
+			if i < len(row) {
+				values[i] = sqlCellValue(row[i])
+			}
+		}
+		if _, err = tx.Exec(insert, values...); err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// querySQLTable runs the query against the database, which is opened read-only, or an in-memory database if dbPath is empty, and returns the result set with the column names as the header.
+func querySQLTable(dbPath string, sources []sqlTableSource, query string) (tableData [][]string, err error) {
+	dataSourceName := ":memory:"
+	if dbPath != "" {
+		// Opening a missing file would create an empty database
+		if _, err = os.Stat(dbPath); err != nil {
+			return
+		}
+		// The path is escaped so that "?", "#" and "%" in it are not parts of the URI syntax
+		escapedPath := (&url.URL{Path: filepath.ToSlash(dbPath)}).EscapedPath()
+		dataSourceName = (&url.URL{Scheme: "file", Opaque: escapedPath, RawQuery: "mode=ro"}).String()
+	}
+	db, err := sql.Open("sqlite", dataSourceName)
+	if err != nil {
+		return
+	}
+	defer (func() { Ignore(db.Close()) })()
+	// Temporary tables exist only in the connection that creates them
+	db.SetMaxOpenConns(1)
+	for _, source := range sources {
+		if err = createSQLTable(db, source); err != nil {
+			return nil, fmt.Errorf("table %s: %w", source.name, err)
+		}
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return
+	}
+	defer (func() { Ignore(rows.Close()) })()
+	columns, err := rows.Columns()
+	if err != nil {
+		return
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("query returns no columns: %s", query)
+	}
+	tableData = append(tableData, columns)
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(columns))
+		for i, value := range values {
+			row[i] = formatSQLValue(value)
+		}
+		tableData = append(tableData, row)
+	}
+	return tableData, rows.Err()
+}
+
+// processSQLDirective processes a SQL directive, which replaces the table before the directive with the result set of a query, writes the result to writer, and returns the new writing position.
+func processSQLDirective(
+	sourceMD []byte, // The source markdown content
+	writer io.Writer, // The output destination
+	writePos int, // The current write position in the source
+	directiveNode *gmast.HTMLBlock, // The HTML block node containing the SQL directive
+	argsText string, // The arguments of the directive
+	params *processParams, // The processing parameters
+) (
+	nextWritePos int, // The next write position after processing
+) {
+	dbPath, sources, query, err := parseSQLArgs(argsText)
+	if err != nil {
+		params.warnf("%v", err)
+		return writePos
+	}
+	return processTable(sourceMD, writer, writePos, directiveNode, func(content *tableContent) {
+		resultData, err := querySQLTable(dbPath, sources, query)
+		if err != nil {
+			params.warnf("SQL: %v", err)
+			return
+		}
+		content.rows = resultData
+	}, params)
+}
@@ -1,15 +1,13 @@
 package mdpp
 
 import (
-	"bufio"
-	"encoding/csv"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"strings"
 
-	"github.com/knaka/tblcalc/mlr"
 	"github.com/knaka/tblcalc/tblfm"
 
 	gmast "github.com/yuin/goldmark/ast"
@@ -29,13 +27,38 @@ func getPrefixStart(sourceMD []byte, blockStart int) (prefixStart int) {
 	return // Should not be reached
 }
 
+// extractTableData returns the values of the cells of the table, and whether the first row is the header.
+func extractTableData(sourceMD []byte, table *gmextast.Table) (tableData [][]string, hasHeader bool) {
+	for rowNode := table.FirstChild(); rowNode != nil; rowNode = rowNode.NextSibling() {
+		if _, ok := rowNode.(*gmextast.TableHeader); ok {
+			hasHeader = true
+		}
+		var rowData []string
+		for cellNode := rowNode.FirstChild(); cellNode != nil; cellNode = cellNode.NextSibling() {
+			if cell, ok := cellNode.(*gmextast.TableCell); ok {
+				rowData = append(rowData, decodeTableCell(tableCellText(sourceMD, cell)))
+			}
+		}
+		tableData = append(tableData, rowData)
+	}
+	return
+}
+
+// tableContent holds the cells of a table and the alignments of its columns.
+type tableContent struct {
+	rows       [][]string           // The cells of the rows
+	hasHeader  bool                 // Whether the first row is the header
+	alignments []gmextast.Alignment // The alignments of the columns
+}
+
 // processTable processes a table with a custom processing function, writes the result to writer, and returns the new writing position.
 func processTable(
 	sourceMD []byte, // The source markdown content
 	writer io.Writer, // The output destination
 	writePos int, // The current write position in the source
 	directiveNode *gmast.HTMLBlock, // The HTML block node containing the directive
-	processFunc func(tableData [][]string, hasHeader bool) [][]string, // The function to process table data
+	processFunc func(content *tableContent), // The function to process the table content in place
+	params *processParams, // The processing parameters
 ) (
 	nextWritePos int, // The next write position after processing
 ) {
@@ -47,25 +70,16 @@ func processTable(
 
 	// Extract table data
 	table, _ := tableNode.(*gmextast.Table)
-	hasHeader := false
-	var tableData [][]string
-	for rowNode := table.FirstChild(); rowNode != nil; rowNode = rowNode.NextSibling() {
-		if _, ok := rowNode.(*gmextast.TableHeader); ok {
-			hasHeader = true
-		}
-		var rowData []string
-		for cellNode := rowNode.FirstChild(); cellNode != nil; cellNode = cellNode.NextSibling() {
-			if cell, ok := cellNode.(*gmextast.TableCell); ok {
-				cellLines := cell.Lines()
-				cellText := string(sourceMD[cellLines.At(0).Start:cellLines.At(0).Stop])
-				rowData = append(rowData, cellText)
-			}
-		}
-		tableData = append(tableData, rowData)
-	}
+	tableData, hasHeader := extractTableData(sourceMD, table)
 
 	// Process table data with the provided function
-	processedTableData := processFunc(tableData, hasHeader)
+	content := &tableContent{
+		rows:       tableData,
+		hasHeader:  hasHeader,
+		alignments: table.Alignments,
+	}
+	processFunc(content)
+	params.setComputedTable(table, content.rows)
 
 	// Get table boundaries
 	var tableStartPos, linePrefixStartPos int
@@ -82,9 +96,26 @@ func processTable(
 	if !ok {
 		panic("ad0e1f3")
 	}
+	// The cells missing from a short row are appended without text
+	for lastCell.Lines().Len() == 0 {
+		if lastCell, ok = lastCell.PreviousSibling().(*gmextast.TableCell); !ok {
+			panic("b0c7e2d")
+		}
+	}
 	segments = lastCell.Lines()
 	lastCellEnd := segments.At(segments.Len() - 1).Stop
 	tableEndPos = getTableEndPosition(sourceMD, lastCellEnd)
+	if _, ok := table.LastChild().(*gmextast.TableHeader); ok {
+		// A table without body rows ends with the delimiter row that follows the header row
+		if i := bytes.IndexByte(sourceMD[tableEndPos:], '\n'); i >= 0 {
+			delimiterRowStart := tableEndPos + i + 1
+			delimiterRow := sourceMD[delimiterRowStart:]
+			if j := bytes.IndexByte(delimiterRow, '\n'); j >= 0 {
+				delimiterRow = delimiterRow[:j]
+			}
+			tableEndPos = delimiterRowStart + len(bytes.TrimRight(delimiterRow, " \t\r"))
+		}
+	}
 
 	Must(writer.Write(sourceMD[writePos:linePrefixStartPos]))
 
@@ -94,28 +125,7 @@ func processTable(
 	}
 
 	// Write processed table
-	var lines []string
-	for rowIndex, rowData := range processedTableData {
-		lines = append(lines, linePrefix+"| "+strings.Join(rowData, " | ")+" |")
-		if rowIndex == 0 && hasHeader {
-			separators := make([]string, len(rowData))
-			for i := range separators {
-				if i >= len(table.Alignments) {
-					separators[i] = "---"
-					continue
-				}
-				switch table.Alignments[i] {
-				case gmextast.AlignLeft:
-					separators[i] = ":---"
-				case gmextast.AlignCenter:
-					separators[i] = ":---:"
-				case gmextast.AlignRight, gmextast.AlignNone:
-					separators[i] = "---"
-				}
-			}
-			lines = append(lines, linePrefix+"| "+strings.Join(separators, " | ")+" |")
-		}
-	}
+	lines := formatTable(content.rows, content.hasHeader, content.alignments, linePrefix, params.config.Table.Compact)
 	Must(writer.Write([]byte(strings.Join(lines, "\n"))))
 
 	directiveLines := directiveNode.Lines()
@@ -132,42 +142,18 @@ func processMillerTable(
 	writePos int, // The current write position in the source
 	directiveNode *gmast.HTMLBlock, // The HTML block node containing the Miller directive
 	millerScript string, // The Miller script to process the table
+	params *processParams, // The processing parameters
 ) (
 	nextWritePos int, // The next write position after processing
 ) {
-	return processTable(sourceMD, writer, writePos, directiveNode, func(tableData [][]string, hasHeader bool) [][]string {
-		tempIn := Value(os.CreateTemp("", "data-*.tsv"))
-		tempInPath := tempIn.Name()
-		defer (func() {
-			Ignore(tempIn.Close())
-			Must(os.Remove(tempInPath))
-		})()
-		for _, rowData := range tableData {
-			Must(fmt.Fprintln(tempIn, strings.Join(rowData, "\t")))
-		}
-		Must(tempIn.Close())
-		tempOut := Value(os.CreateTemp("", "data-*.tsv"))
-		tempOutPath := tempOut.Name()
-		defer (func() {
-			Ignore(tempOut.Close())
-			Must(os.Remove(tempOutPath))
-		})()
-		err := mlr.Put(
-			[]string{tempInPath},
-			[]string{millerScript},
-			true,
-			"tsv",
-			"tsv",
-			tempOut,
-		)
+	return processTable(sourceMD, writer, writePos, directiveNode, func(content *tableContent) {
+		resultData, err := runMiller(content.rows, millerScript)
 		if err != nil {
-			return tableData
+			params.warnf("MILLER: %v", err)
+			return
 		}
-		Must(tempOut.Close())
-		tempOut2 := Value(os.Open(tempOutPath))
-		defer (func() { Must(tempOut2.Close()) })()
-		return Value(loadTableFromReader(tempOut2, "tsv"))
-	})
+		content.rows = resultData
+	}, params)
 }
 
 // getTableStartPosition searches backward from cellStart to find the pipe character '|' that marks the start of the table,
@@ -204,56 +190,123 @@ func processTBLFMTable(
 	writePos int, // The current write position in the source
 	directiveNode *gmast.HTMLBlock, // The HTML block node containing the TBLFM directive
 	tblfmScripts []string, // The TBLFM scripts to process the table
+	params *processParams, // The processing parameters
 ) (
 	nextWritePos int, // The next write position after processing
 ) {
-	return processTable(sourceMD, writer, writePos, directiveNode, func(tableData [][]string, hasHeader bool) [][]string {
+	return processTable(sourceMD, writer, writePos, directiveNode, func(content *tableContent) {
 		// Apply TBLFM formulas
-		Must(tblfm.Apply(tableData, tblfmScripts, tblfm.WithHeader(hasHeader)))
-		return tableData
-	})
+		Must(tblfm.Apply(content.rows, tblfmScripts, tblfm.WithHeader(content.hasHeader)))
+	}, params)
 }
 
-// loadTableFromReader loads table data from a reader in the specified format.
-// format should be "csv" or "tsv".
-func loadTableFromReader(reader io.Reader, format string) ([][]string, error) {
-	if format == "csv" {
-		csvReader := csv.NewReader(reader)
-		return csvReader.ReadAll()
-	}
+// tableFormats maps file extensions to the formats of table data.
+var tableFormats = map[string]string{
+	".csv":    "csv",
+	".tsv":    "tsv",
+	".json":   "json",
+	".jsonl":  "jsonl",
+	".ndjson": "jsonl",
+	".yaml":   "yaml",
+	".yml":    "yaml",
+	".xlsx":   "xlsx",
+	".ods":    "ods",
+}
+
+// tableLoadOptions holds the options of how to load table data from a file.
+type tableLoadOptions struct {
+	format     string     // The format of the file, or "" to determine it by the file extension
+	sheet      string     // The name of the sheet of a spreadsheet, or "" for the first sheet
+	cellRange  *cellRange // The range of the cells of a spreadsheet, or nil for the used cells
+	delimiter  rune       // The delimiter of the fields of CSV and TSV files, or 0 for the default of the format
+	quote      bool       // Whether TSV fields can be quoted as CSV fields
+	comment    rune       // The character that starts comment lines of CSV and TSV files, or 0 for none
+	lazyQuotes bool       // Whether quotes can appear in unquoted fields, and non-doubled quotes in quoted fields
+	skip       int        // The number of lines to skip at the beginning of text files
+	encoding   string     // The character encoding of text files, or "" for UTF-8
+	noHeader   bool       // Whether the first row is data rather than the header
+	headers    []string   // The names of the columns of a file without the header row
+}
 
-	// For TSV files, use bufio.Scanner to read line by line
-	var tableData [][]string
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) > 0 {
-			tableData = append(tableData, strings.Split(line, "\t"))
+// parseTableLoadOptions parses the options of a directive that specify how to load table data.
+func parseTableLoadOptions(args *directiveArgs) (opts *tableLoadOptions, err error) {
+	opts = &tableLoadOptions{}
+	opts.format, _ = args.get("format")
+	opts.format = strings.ToLower(opts.format)
+	opts.sheet, _ = args.get("sheet")
+	if value, ok := args.get("range"); ok {
+		if opts.cellRange, err = parseCellRange(value); err != nil {
+			return nil, err
 		}
 	}
-	if err := scanner.Err(); err != nil {
+	if err = parseDialectOptions(args, opts); err != nil {
 		return nil, err
 	}
-	return tableData, nil
+	return
 }
 
-// loadTableFromFile loads table data from a CSV or TSV file based on file extension.
-func loadTableFromFile(filePath string) ([][]string, error) {
+// loadTableFromReader loads table data from a reader in the format of the options.
+// The format should be "csv", "tsv", "json", "jsonl" or "yaml".
+func loadTableFromReader(reader io.Reader, opts *tableLoadOptions) ([][]string, error) {
+	format := opts.format
+	if format == "csv" || format == "tsv" {
+		return readDelimited(reader, opts)
+	}
+	// The other formats hold records that are flattened into rows
+	var records []any
+	var err error
+	switch format {
+	case "json":
+		records, err = loadJSONRecords(reader)
+	case "jsonl":
+		records, err = loadJSONLRecords(reader)
+	case "yaml":
+		records, err = loadYAMLRecords(reader)
+	default:
+		return nil, fmt.Errorf("unsupported table format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return recordsToTable(records)
+}
+
+// loadTableFromFile loads table data from a file in the format of the options, or in the format determined by the file extension.
+func loadTableFromFile(filePath string, opts *tableLoadOptions) ([][]string, error) {
+	format := opts.format
+	if format == "" {
+		ext := strings.ToLower(path.Ext(filePath))
+		var ok bool
+		if format, ok = tableFormats[ext]; !ok {
+			return nil, fmt.Errorf("unsupported table file type: %s (specify format=csv, tsv, json, jsonl, yaml, xlsx or ods)", filePath)
+		}
+	}
+	if format == "xlsx" || format == "ods" {
+		tableData, err := loadSpreadsheet(filePath, format, opts.sheet, opts.cellRange)
+		if err == nil && opts.noHeader {
+			tableData = addHeader(tableData, opts.headers)
+		}
+		return tableData, err
+	}
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer (func() { Must(file.Close()) })()
-
-	ext := strings.ToLower(path.Ext(filePath))
-
-	// Use encoding/csv for CSV files to properly handle quoted fields, commas, and newlines
-	format := "tsv"
-	if ext == ".csv" || ext == "" {
-		format = "csv"
+	reader, err := decodeTableReader(file, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	return loadTableFromReader(file, format)
+	formatOpts := *opts
+	formatOpts.format = format
+	tableData, err := loadTableFromReader(reader, &formatOpts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.noHeader && (format == "csv" || format == "tsv") {
+		tableData = addHeader(tableData, opts.headers)
+	}
+	return tableData, nil
 }
 
 // processTableInclude processes a table include directive, loads data from file, and writes the result to writer.
@@ -262,22 +315,52 @@ func processTableInclude(
 	writer io.Writer, // The output destination
 	writePos int, // The current write position in the source
 	directiveNode *gmast.HTMLBlock, // The HTML block node containing the directive
-	filePath string, // The path to the file to include
+	argsText string, // The arguments of the directive
+	params *processParams, // The processing parameters
 ) (
 	nextWritePos int, // The next write position after processing
 ) {
-	return processTable(sourceMD, writer, writePos, directiveNode, func(tableData [][]string, hasHeader bool) [][]string {
+	args := &directiveArgs{}
+	filePath := argsText
+	// The whole text is the path of an existing file as it has been before the options, even if it contains spaces or "="
+	if _, err := os.Stat(argsText); err != nil {
+		args, err = parseDirectiveArgs(argsText)
+		if err != nil {
+			params.warnf("%v", err)
+			return writePos
+		}
+		if len(args.positional) == 0 {
+			params.warnf("TABLE_INCLUDE requires a file: %s", argsText)
+			return writePos
+		}
+		filePath = args.positional[0]
+	}
+	loadOpts, err := parseTableLoadOptions(args)
+	if err != nil {
+		params.warnf("TABLE_INCLUDE %s: %v", filePath, err)
+		return writePos
+	}
+	return processTable(sourceMD, writer, writePos, directiveNode, func(content *tableContent) {
 		// Load table data from file and replace the existing table
-		loadedData, err := loadTableFromFile(filePath)
+		loadedData, err := loadTableFromFile(filePath, loadOpts)
 		if err != nil {
-			// If file cannot be read, return original table data
-			return tableData
+			// If file cannot be read, keep the original table data
+			params.warnf("TABLE_INCLUDE %s: %v", filePath, err)
+			return
 		}
 		if len(loadedData) == 0 {
-			// If file is empty, return original table data
-			return tableData
+			// If file is empty, keep the original table data
+			return
+		}
+		// The first row of the loaded data is the header
+		rows, alignments, err := applyTableOptions(loadedData, args)
+		if err != nil {
+			params.warnf("TABLE_INCLUDE %s: %v", filePath, err)
+			return
+		}
+		content.rows = rows
+		if alignments != nil {
+			content.alignments = alignments
 		}
-		// Return loaded data (assuming first row is header)
-		return loadedData
-	})
+	}, params)
 }
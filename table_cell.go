@@ -0,0 +1,43 @@
+package mdpp
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	gmextast "github.com/yuin/goldmark/extension/ast"
+)
+
+// regexpLineBreakTag matches the line break tags that represent newlines in table cells, e.g. "<br>", "<br/>" and "<br />".
+var regexpLineBreakTag = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?i)<br[ \t]*/?>`)
+})
+
+// tableCellText returns the raw Markdown text of a table cell, including the inline formatting and the escaped pipes.
+func tableCellText(sourceMD []byte, cell *gmextast.TableCell) string {
+	var text strings.Builder
+	cellLines := cell.Lines()
+	for i := range cellLines.Len() {
+		segment := cellLines.At(i)
+		text.Write(segment.Value(sourceMD))
+	}
+	return text.String()
+}
+
+// decodeTableCell decodes the raw Markdown text of a table cell into its value. Escaped pipes are unescaped and line break tags become newlines. The other inline Markdown, such as code spans, links and emphasis, is kept as it is.
+func decodeTableCell(text string) string {
+	text = strings.ReplaceAll(text, `\|`, "|")
+	return regexpLineBreakTag().ReplaceAllString(text, "\n")
+}
+
+// encodeTableCell encodes the value of a table cell into Markdown text that fits in a table row. Pipes are escaped, even in code spans, and newlines become line break tags. encodeTableCell is the inverse of decodeTableCell.
+func encodeTableCell(value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	value = strings.ReplaceAll(value, "|", `\|`)
+	return strings.ReplaceAll(value, "\n", "<br>")
+}
+
+// tsvEncodeField escapes a field for TSV as Miller does, i.e. backslashes, tabs and newlines as `\\`, `\t` and `\n`.
+func tsvEncodeField(field string) string {
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(field)
+}
@@ -0,0 +1,150 @@
+package mdpp
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	gmextast "github.com/yuin/goldmark/extension/ast"
+)
+
+// findColumn returns the index of the column specified by the header name or the 1-based index. A header name takes precedence over an index.
+func findColumn(header []string, spec string) (int, error) {
+	for i, name := range header {
+		if name == spec {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(spec); err == nil && n >= 1 && n <= len(header) {
+		return n - 1, nil
+	}
+	return 0, fmt.Errorf("unknown column: %s", spec)
+}
+
+// selectColumns rearranges the rows in place to have only the specified columns in the specified order.
+func selectColumns(rows [][]string, specs []string) error {
+	indexes := make([]int, len(specs))
+	for i, spec := range specs {
+		index, err := findColumn(rows[0], spec)
+		if err != nil {
+			return err
+		}
+		indexes[i] = index
+	}
+	for rowIndex, row := range rows {
+		selected := make([]string, len(indexes))
+		for i, index := range indexes {
+			if index < len(row) {
+				selected[i] = row[index]
+			}
+		}
+		rows[rowIndex] = selected
+	}
+	return nil
+}
+
+// renameColumns renames the header cells according to the pairs such as "Price:Unit price".
+func renameColumns(header []string, pairs []string) error {
+	for _, pair := range pairs {
+		spec, name, found := strings.Cut(pair, ":")
+		if !found {
+			return fmt.Errorf("rename requires OLD:NEW: %s", pair)
+		}
+		index, err := findColumn(header, spec)
+		if err != nil {
+			return err
+		}
+		header[index] = name
+	}
+	return nil
+}
+
+// parseAlignment parses the name of an alignment such as "left" or "r".
+func parseAlignment(name string) (gmextast.Alignment, error) {
+	switch strings.ToLower(name) {
+	case "left", "l":
+		return gmextast.AlignLeft, nil
+	case "right", "r":
+		return gmextast.AlignRight, nil
+	case "center", "c":
+		return gmextast.AlignCenter, nil
+	case "none", "":
+		return gmextast.AlignNone, nil
+	}
+	return gmextast.AlignNone, fmt.Errorf("unknown alignment: %s", name)
+}
+
+// columnAlignments returns the alignments of the columns specified either in order, e.g. "left,right", or by column, e.g. "Price:right".
+func columnAlignments(header []string, specs []string) ([]gmextast.Alignment, error) {
+	alignments := make([]gmextast.Alignment, len(header))
+	for i := range alignments {
+		alignments[i] = gmextast.AlignNone
+	}
+	for i, spec := range specs {
+		index := i
+		name := spec
+		if column, alignmentName, found := strings.Cut(spec, ":"); found {
+			var err error
+			if index, err = findColumn(header, column); err != nil {
+				return nil, err
+			}
+			name = alignmentName
+		} else if i >= len(header) {
+			return nil, fmt.Errorf("more alignments than columns: %s", strings.Join(specs, ","))
+		}
+		alignment, err := parseAlignment(name)
+		if err != nil {
+			return nil, err
+		}
+		alignments[index] = alignment
+	}
+	return alignments, nil
+}
+
+// applyTableOptions applies the options of a directive to the rows, whose first row is the header. The rows are filtered by where and sorted by sort on the columns of the file, and then reduced by columns, distinct and limit. It returns the resulting rows and the alignments of the columns if the align option is set, or nil otherwise.
+func applyTableOptions(rows [][]string, args *directiveArgs) (result [][]string, alignments []gmextast.Alignment, err error) {
+	header, body := rows[0], rows[1:]
+	for _, expr := range args.all("where") {
+		var condition *rowCondition
+		if condition, err = parseRowCondition(header, expr); err != nil {
+			return
+		}
+		body = slices.DeleteFunc(slices.Clone(body), func(row []string) bool {
+			return !condition.match(row)
+		})
+	}
+	if value, ok := args.get("sort"); ok {
+		var keys []sortKey
+		if keys, err = parseSortKeys(header, strings.Split(value, ",")); err != nil {
+			return
+		}
+		body = slices.Clone(body)
+		sortRows(body, keys)
+	}
+	result = append([][]string{header}, body...)
+	if value, ok := args.get("columns"); ok {
+		if err = selectColumns(result, strings.Split(value, ",")); err != nil {
+			return
+		}
+	}
+	if args.flag("distinct") {
+		result = append(result[:1:1], distinctRows(result[1:])...)
+	}
+	limit, err := args.getInt("limit", -1)
+	if err != nil {
+		return
+	}
+	if limit >= 0 && len(result)-1 > limit {
+		result = result[:limit+1]
+	}
+	for _, value := range args.all("rename") {
+		if err = renameColumns(result[0], strings.Split(value, ",")); err != nil {
+			return
+		}
+	}
+	if value, ok := args.get("align"); ok {
+		alignments, err = columnAlignments(result[0], strings.Split(value, ","))
+	}
+	return
+}
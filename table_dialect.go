@@ -0,0 +1,155 @@
+package mdpp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// parseDialectRune parses the value of an option that is a single character, such as the delimiter. Tabs can be written as "tab" or `\t`.
+func parseDialectRune(key, value string) (rune, error) {
+	switch strings.ToLower(value) {
+	case "tab", `\t`:
+		return '\t', nil
+	case "space":
+		return ' ', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if r == utf8.RuneError || size != len(value) {
+		return 0, fmt.Errorf("%s requires a single character: %s", key, value)
+	}
+	return r, nil
+}
+
+// parseDialectOptions parses the options that specify the dialect of CSV and TSV files, and how to read the header of tabular files, into opts.
+func parseDialectOptions(args *directiveArgs, opts *tableLoadOptions) (err error) {
+	if value, ok := args.get("delimiter"); ok {
+		if opts.delimiter, err = parseDialectRune("delimiter", value); err != nil {
+			return
+		}
+	}
+	if value, ok := args.get("comment"); ok {
+		if opts.comment, err = parseDialectRune("comment", value); err != nil {
+			return
+		}
+	}
+	opts.quote = args.flag("quote")
+	opts.lazyQuotes = args.flag("lazyquotes")
+	if opts.skip, err = args.getInt("skip", 0); err != nil {
+		return
+	}
+	opts.encoding, _ = args.get("encoding")
+	if _, err = textDecoder(opts.encoding); err != nil {
+		return
+	}
+	if value, ok := args.get("header"); ok {
+		switch strings.ToLower(value) {
+		case "none", "false", "no":
+			opts.noHeader = true
+		case "first", "true", "yes":
+		default:
+			return fmt.Errorf("header requires none or first: %s", value)
+		}
+	}
+	if value, ok := args.get("headers"); ok {
+		opts.noHeader = true
+		opts.headers = strings.Split(value, ",")
+	}
+	return
+}
+
+// textDecoder returns the decoder of the character encoding such as "shift_jis" or "utf-16". The names are the ones of the WHATWG Encoding Standard. Without an encoding, UTF-8 is decoded, and a byte order mark selects UTF-16.
+func textDecoder(name string) (transform.Transformer, error) {
+	switch strings.ToLower(name) {
+	case "", "utf-8", "utf8":
+		return unicode.BOMOverride(encoding.Nop.NewDecoder()), nil
+	case "utf-16", "utf16":
+		// The byte order mark determines the endianness, which is little-endian without one
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder(), nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding: %s", name)
+	}
+	return enc.NewDecoder(), nil
+}
+
+// skipLines skips the first n lines of the reader.
+func skipLines(reader *bufio.Reader, n int) error {
+	for range n {
+		if _, err := reader.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readDelimited reads the rows of a CSV or TSV file in the dialect of the options. Without the quote option, TSV fields are split at tabs, quotes are read as they are, and blank lines are rows of an empty cell.
+func readDelimited(reader io.Reader, opts *tableLoadOptions) (tableData [][]string, err error) {
+	delimiter := opts.delimiter
+	if delimiter == 0 {
+		delimiter = ','
+		if opts.format == "tsv" {
+			delimiter = '\t'
+		}
+	}
+	if opts.format == "csv" || opts.quote {
+		csvReader := csv.NewReader(reader)
+		csvReader.Comma = delimiter
+		csvReader.Comment = opts.comment
+		csvReader.LazyQuotes = opts.lazyQuotes
+		return csvReader.ReadAll()
+	}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		// Blank lines are rows of empty cells, and only comment lines are skipped
+		if opts.comment != 0 && strings.HasPrefix(line, string(opts.comment)) {
+			continue
+		}
+		tableData = append(tableData, strings.Split(line, string(delimiter)))
+	}
+	return tableData, scanner.Err()
+}
+
+// addHeader adds the header to the rows of a file that has no header row. The columns without supplied names are named "Column1", "Column2", and so on.
+func addHeader(tableData [][]string, headers []string) [][]string {
+	numColumns := len(headers)
+	for _, row := range tableData {
+		numColumns = max(numColumns, len(row))
+	}
+	header := make([]string, numColumns)
+	for i := range header {
+		if i < len(headers) {
+			header[i] = headers[i]
+		} else {
+			header[i] = "Column" + strconv.Itoa(i+1)
+		}
+	}
+	return append([][]string{header}, tableData...)
+}
+
+// decodeTableReader returns the reader of the text of a file in the encoding of the options, after skipping the lines to skip.
+func decodeTableReader(reader io.Reader, opts *tableLoadOptions) (io.Reader, error) {
+	decoder, err := textDecoder(opts.encoding)
+	if err != nil {
+		return nil, err
+	}
+	textReader := bufio.NewReader(transform.NewReader(reader, decoder))
+	if err := skipLines(textReader, opts.skip); err != nil {
+		return nil, err
+	}
+	return textReader, nil
+}
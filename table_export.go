@@ -0,0 +1,170 @@
+package mdpp
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/knaka/go-utils/funcopt"
+	gmast "github.com/yuin/goldmark/ast"
+	gmextast "github.com/yuin/goldmark/extension/ast"
+)
+
+// tableExportFormats maps file extensions to the formats that tables are exported in.
+var tableExportFormats = map[string]string{
+	".csv":  "csv",
+	".tsv":  "tsv",
+	".json": "json",
+}
+
+// EncodeTable encodes the rows of a table, whose first row is the header, as "csv", "tsv" or "json". TSV fields escape tabs, newlines and backslashes as Miller does, and JSON is an array of objects whose keys are the header cells.
+func EncodeTable(tableData [][]string, format string) ([]byte, error) {
+	var buffer bytes.Buffer
+	switch strings.ToLower(format) {
+	case "csv":
+		csvWriter := csv.NewWriter(&buffer)
+		if err := csvWriter.WriteAll(tableData); err != nil {
+			return nil, err
+		}
+	case "tsv":
+		for _, row := range tableData {
+			fields := make([]string, len(row))
+			for i, cell := range row {
+				fields[i] = tsvEncodeField(cell)
+			}
+			buffer.WriteString(strings.Join(fields, "\t") + "\n")
+		}
+	case "json":
+		records := []orderedObject{}
+		if len(tableData) > 0 {
+			header := tableData[0]
+			for _, row := range tableData[1:] {
+				record := orderedObject{}
+				for i, key := range header {
+					value := ""
+					if i < len(row) {
+						value = row[i]
+					}
+					record = append(record, orderedField{key: key, value: value})
+				}
+				records = append(records, record)
+			}
+		}
+		encoded, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(encoded)
+		buffer.WriteString("\n")
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+	return buffer.Bytes(), nil
+}
+
+// WriteFileIfChanged writes the content to the file unless the file already has the content, so that the modification time of the file changes only when its content does.
+func WriteFileIfChanged(filePath string, content []byte) error {
+	if current, err := os.ReadFile(filePath); err == nil && bytes.Equal(current, content) {
+		return nil
+	}
+	return os.WriteFile(filePath, content, 0o644)
+}
+
+// isDirectiveBlock reports whether the node is an HTML block of a comment, such as a directive that follows a table.
+func isDirectiveBlock(sourceMD []byte, node gmast.Node) bool {
+	htmlBlock, ok := node.(*gmast.HTMLBlock)
+	if !ok || htmlBlock.Lines().Len() == 0 {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(htmlBlock.Lines().Value(sourceMD))), "<!--")
+}
+
+// findDirectiveTable returns the table that precedes the directive, skipping the other directives between them, or nil if there is none.
+func findDirectiveTable(sourceMD []byte, directiveNode gmast.Node) *gmextast.Table {
+	for node := directiveNode.PreviousSibling(); node != nil; node = node.PreviousSibling() {
+		if table, ok := node.(*gmextast.Table); ok {
+			return table
+		}
+		if !isDirectiveBlock(sourceMD, node) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// processTableExportDirective processes a TABLE_EXPORT directive, which writes the values of the preceding table to a file. The values are the ones that the directives between the table and the directive wrote. The Markdown is left as it is, and the returned writing position is writePos.
+func processTableExportDirective(
+	sourceMD []byte, // The source markdown content
+	writePos int, // The current write position in the source
+	directiveNode *gmast.HTMLBlock, // The HTML block node containing the TABLE_EXPORT directive
+	argsText string, // The arguments of the directive
+	params *processParams, // The processing parameters
+) (
+	nextWritePos int, // The next write position after processing
+) {
+	nextWritePos = writePos
+	args, err := parseDirectiveArgs(argsText)
+	if err != nil {
+		params.warnf("%v", err)
+		return
+	}
+	if len(args.positional) == 0 {
+		params.warnf("TABLE_EXPORT requires a file: %s", argsText)
+		return
+	}
+	filePath := args.positional[0]
+	format, ok := args.get("format")
+	if !ok {
+		if format, ok = tableExportFormats[strings.ToLower(filepath.Ext(filePath))]; !ok {
+			params.warnf("TABLE_EXPORT %s: unsupported file type (specify format=csv, tsv or json)", filePath)
+			return
+		}
+	}
+	table := findDirectiveTable(sourceMD, directiveNode)
+	if table == nil {
+		params.warnf("TABLE_EXPORT %s: no table before the directive", filePath)
+		return
+	}
+	tableData, ok := params.computedTables[table]
+	if !ok {
+		tableData, _ = extractTableData(sourceMD, table)
+	}
+	content, err := EncodeTable(tableData, format)
+	if err == nil {
+		err = WriteFileIfChanged(filePath, content)
+	}
+	if err != nil {
+		params.warnf("TABLE_EXPORT %s: %v", filePath, err)
+	}
+	return
+}
+
+// ExtractTables processes the source markdown as Process does and returns the values of the cells of every table in the result, with the header as the first row of each table. If dirPathOpt is not nil, it changes the working directory to that path before processing.
+func ExtractTables(
+	sourceMD []byte,
+	dirPathOpt *string,
+	opts ...funcopt.Option[processParams],
+) (tables [][][]string, err error) {
+	var processedMD bytes.Buffer
+	if err = Process(sourceMD, &processedMD, dirPathOpt, opts...); err != nil {
+		return
+	}
+	resultMD := processedMD.Bytes()
+	gmTree, _ := gmParse(resultMD)
+	err = gmast.Walk(gmTree, func(node gmast.Node, entering bool) (gmast.WalkStatus, error) {
+		if !entering {
+			return gmast.WalkContinue, nil
+		}
+		if table, ok := node.(*gmextast.Table); ok {
+			tableData, _ := extractTableData(resultMD, table)
+			tables = append(tables, tableData)
+			return gmast.WalkSkipChildren, nil
+		}
+		return gmast.WalkContinue, nil
+	})
+	return
+}
@@ -0,0 +1,123 @@
+package mdpp
+
+import (
+	"strings"
+	"unicode"
+
+	gmextast "github.com/yuin/goldmark/extension/ast"
+	"golang.org/x/text/width"
+)
+
+// minColumnWidth returns the minimum width of a column, which is the width of the shortest delimiter for the alignment, e.g. ":---".
+func minColumnWidth(alignment gmextast.Alignment) int {
+	switch alignment {
+	case gmextast.AlignLeft, gmextast.AlignRight:
+		return 4
+	case gmextast.AlignCenter:
+		return 5
+	default:
+		return 3
+	}
+}
+
+// displayWidth returns the number of cells that the text occupies in a monospace font. East Asian wide and fullwidth characters occupy two cells, and combining marks occupy none.
+func displayWidth(text string) int {
+	n := 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case width.LookupRune(r).Kind() == width.EastAsianWide || width.LookupRune(r).Kind() == width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// alignCell pads the text with spaces to the width according to the alignment.
+func alignCell(text string, cellWidth int, alignment gmextast.Alignment) string {
+	padding := max(cellWidth-displayWidth(text), 0)
+	switch alignment {
+	case gmextast.AlignRight:
+		return strings.Repeat(" ", padding) + text
+	case gmextast.AlignCenter:
+		return strings.Repeat(" ", padding/2) + text + strings.Repeat(" ", padding-padding/2)
+	default:
+		return text + strings.Repeat(" ", padding)
+	}
+}
+
+// delimiterCell returns the cell of the delimiter row for the alignment, e.g. ":---:".
+func delimiterCell(cellWidth int, alignment gmextast.Alignment) string {
+	switch alignment {
+	case gmextast.AlignLeft:
+		return ":" + strings.Repeat("-", cellWidth-1)
+	case gmextast.AlignRight:
+		return strings.Repeat("-", cellWidth-1) + ":"
+	case gmextast.AlignCenter:
+		return ":" + strings.Repeat("-", cellWidth-2) + ":"
+	default:
+		return strings.Repeat("-", cellWidth)
+	}
+}
+
+// formatTable formats the rows as the lines of a Markdown table, encoding the cells with encodeTableCell, with the delimiter row after the first row if it is the header. Columns are padded to equal display widths unless compact is set. Columns without an alignment are left-aligned.
+func formatTable(
+	rows [][]string, // The cells of the rows
+	hasHeader bool, // Whether the first row is the header
+	alignments []gmextast.Alignment, // The alignments of the columns
+	linePrefix string, // The prefix of each line, e.g. "> " in a blockquote
+	compact bool, // Whether to write the cells without padding
+) (lines []string) {
+	numColumns := 0
+	encodedRows := make([][]string, len(rows))
+	for rowIndex, row := range rows {
+		numColumns = max(numColumns, len(row))
+		encodedRows[rowIndex] = make([]string, len(row))
+		for i, cell := range row {
+			encodedRows[rowIndex][i] = encodeTableCell(cell)
+		}
+	}
+	rows = encodedRows
+	columnAlignments := make([]gmextast.Alignment, numColumns)
+	for i := range columnAlignments {
+		columnAlignments[i] = gmextast.AlignNone
+		if i < len(alignments) {
+			columnAlignments[i] = alignments[i]
+		}
+	}
+	columnWidths := make([]int, numColumns)
+	for i := range columnWidths {
+		columnWidths[i] = minColumnWidth(columnAlignments[i])
+	}
+	if !compact {
+		for _, row := range rows {
+			for i, cell := range row {
+				columnWidths[i] = max(columnWidths[i], displayWidth(cell))
+			}
+		}
+	}
+	for rowIndex, row := range rows {
+		cells := make([]string, numColumns)
+		for i := range cells {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			cells[i] = cell
+			if !compact {
+				cells[i] = alignCell(cell, columnWidths[i], columnAlignments[i])
+			}
+		}
+		lines = append(lines, linePrefix+"| "+strings.Join(cells, " | ")+" |")
+		if rowIndex == 0 && hasHeader {
+			delimiters := make([]string, numColumns)
+			for i := range delimiters {
+				delimiters[i] = delimiterCell(columnWidths[i], columnAlignments[i])
+			}
+			lines = append(lines, linePrefix+"| "+strings.Join(delimiters, " | ")+" |")
+		}
+	}
+	return
+}
@@ -0,0 +1,258 @@
+package mdpp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// orderedField is a field of an orderedObject.
+type orderedField struct {
+	key   string
+	value any
+}
+
+// orderedObject is a JSON or YAML object that keeps the order of its keys, which becomes the order of the columns.
+type orderedObject []orderedField
+
+// MarshalJSON encodes the object with the keys in order.
+func (object orderedObject) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, field := range object {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// decodeOrderedJSON decodes the next JSON value from the decoder, with objects as orderedObject and numbers as json.Number.
+func decodeOrderedJSON(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := orderedObject{}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, orderedField{key: keyToken.(string), value: value})
+		}
+		// Consume the closing brace
+		_, err = decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []any{}
+		for decoder.More() {
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		// Consume the closing bracket
+		_, err = decoder.Token()
+		return array, err
+	}
+	return token, nil
+}
+
+// convertYAMLNode converts a YAML node into the same kinds of values as decodeOrderedJSON returns.
+func convertYAMLNode(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return convertYAMLNode(node.Content[0])
+	case yaml.AliasNode:
+		return convertYAMLNode(node.Alias)
+	case yaml.MappingNode:
+		object := orderedObject{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := convertYAMLNode(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, orderedField{key: node.Content[i].Value, value: value})
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		array := []any{}
+		for _, child := range node.Content {
+			value, err := convertYAMLNode(child)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	}
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var value bool
+		err := node.Decode(&value)
+		return value, err
+	case "!!int", "!!float":
+		// Keep numbers as written, e.g. "1.0" rather than "1"
+		if json.Valid([]byte(node.Value)) {
+			return json.Number(node.Value), nil
+		}
+	}
+	return node.Value, nil
+}
+
+// flattenRecord appends the fields of the object to the record, with the keys of nested objects joined by dots, e.g. "author.name". Arrays are kept as compact JSON.
+func flattenRecord(record orderedObject, prefix string, object orderedObject) (orderedObject, error) {
+	for _, field := range object {
+		key := prefix + field.key
+		if nested, ok := field.value.(orderedObject); ok && len(nested) > 0 {
+			var err error
+			if record, err = flattenRecord(record, key+".", nested); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		record = append(record, orderedField{key: key, value: field.value})
+	}
+	return record, nil
+}
+
+// formatRecordValue formats a value of a flattened record as the text of a table cell.
+func formatRecordValue(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool, float64:
+		return fmt.Sprint(value), nil
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
+
+// recordsToTable converts the records into table data. The header consists of the keys in the order of their first appearance, and the cells of the keys missing from a record are empty.
+func recordsToTable(records []any) ([][]string, error) {
+	var header []string
+	columns := map[string]int{}
+	var flattened []orderedObject
+	for i, record := range records {
+		object, ok := record.(orderedObject)
+		if !ok {
+			return nil, fmt.Errorf("record %d is not an object", i+1)
+		}
+		fields, err := flattenRecord(nil, "", object)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			if _, ok := columns[field.key]; !ok {
+				columns[field.key] = len(header)
+				header = append(header, field.key)
+			}
+		}
+		flattened = append(flattened, fields)
+	}
+	if len(header) == 0 {
+		return nil, nil
+	}
+	tableData := [][]string{header}
+	for _, fields := range flattened {
+		row := make([]string, len(header))
+		for _, field := range fields {
+			text, err := formatRecordValue(field.value)
+			if err != nil {
+				return nil, err
+			}
+			row[columns[field.key]] = text
+		}
+		tableData = append(tableData, row)
+	}
+	return tableData, nil
+}
+
+// loadJSONRecords loads the records of a JSON array of objects.
+func loadJSONRecords(reader io.Reader) ([]any, error) {
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	data, err := decodeOrderedJSON(decoder)
+	if err != nil {
+		return nil, err
+	}
+	records, ok := data.([]any)
+	if !ok {
+		return nil, fmt.Errorf("not an array of objects")
+	}
+	return records, nil
+}
+
+// loadJSONLRecords loads the records of JSON Lines, which has an object on each line. Blank lines are skipped.
+func loadJSONLRecords(reader io.Reader) (records []any, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		record, err := decodeOrderedJSON(decoder)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// loadYAMLRecords loads the records of a YAML sequence of mappings.
+func loadYAMLRecords(reader io.Reader) ([]any, error) {
+	var node yaml.Node
+	if err := yaml.NewDecoder(reader).Decode(&node); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data, err := convertYAMLNode(&node)
+	if err != nil {
+		return nil, err
+	}
+	records, ok := data.([]any)
+	if !ok {
+		return nil, fmt.Errorf("not a sequence of mappings")
+	}
+	return records, nil
+}
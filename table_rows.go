@@ -0,0 +1,164 @@
+package mdpp
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// regexpRowCondition matches a condition of the where option, e.g. "Stock>=10" or "Name=~^A".
+var regexpRowCondition = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^(.+?)\s*(==|!=|<=|>=|=~|!~|<|>|=)\s*(.*)$`)
+})
+
+// Indexes of the matches of the row condition regex.
+const (
+	rowConditionColumnIndex   = 1
+	rowConditionOperatorIndex = 2
+	rowConditionValueIndex    = 3
+)
+
+// rowCondition is a condition that a row must satisfy to be kept.
+type rowCondition struct {
+	column   int
+	operator string
+	value    string
+	pattern  *regexp.Regexp // The pattern of the =~ and !~ operators
+}
+
+// parseRowCondition parses a condition of the where option against the header.
+func parseRowCondition(header []string, expr string) (*rowCondition, error) {
+	matches := regexpRowCondition().FindStringSubmatch(expr)
+	if matches == nil {
+		return nil, fmt.Errorf("where requires COLUMN OPERATOR VALUE: %s", expr)
+	}
+	column, err := findColumn(header, strings.TrimSpace(matches[rowConditionColumnIndex]))
+	if err != nil {
+		return nil, err
+	}
+	condition := &rowCondition{
+		column:   column,
+		operator: matches[rowConditionOperatorIndex],
+		value:    matches[rowConditionValueIndex],
+	}
+	if condition.operator == "=~" || condition.operator == "!~" {
+		if condition.pattern, err = regexp.Compile(condition.value); err != nil {
+			return nil, err
+		}
+	}
+	return condition, nil
+}
+
+// match reports whether the row satisfies the condition.
+func (condition *rowCondition) match(row []string) bool {
+	cell := ""
+	if condition.column < len(row) {
+		cell = row[condition.column]
+	}
+	switch condition.operator {
+	case "=~":
+		return condition.pattern.MatchString(cell)
+	case "!~":
+		return !condition.pattern.MatchString(cell)
+	}
+	result := compareCells(cell, condition.value)
+	switch condition.operator {
+	case "==", "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	}
+	return false
+}
+
+// compareCells compares two cells numerically if both are numbers, and as strings otherwise. Numbers sort before other strings.
+func compareCells(a, b string) int {
+	numA, errA := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	numB, errB := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	switch {
+	case errA == nil && errB == nil:
+		if numA < numB {
+			return -1
+		} else if numA > numB {
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// sortKey is a column to sort the rows by.
+type sortKey struct {
+	column     int
+	descending bool
+}
+
+// parseSortKeys parses the keys of the sort option, e.g. "-Downloads,Name", where "-" sorts in descending order.
+func parseSortKeys(header []string, specs []string) (keys []sortKey, err error) {
+	for _, spec := range specs {
+		key := sortKey{}
+		if rest, found := strings.CutPrefix(spec, "-"); found {
+			spec, key.descending = rest, true
+		} else {
+			spec = strings.TrimPrefix(spec, "+")
+		}
+		if key.column, err = findColumn(header, spec); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return
+}
+
+// sortRows sorts the rows stably by the keys.
+func sortRows(rows [][]string, keys []sortKey) {
+	slices.SortStableFunc(rows, func(a, b []string) int {
+		for _, key := range keys {
+			cellA, cellB := "", ""
+			if key.column < len(a) {
+				cellA = a[key.column]
+			}
+			if key.column < len(b) {
+				cellB = b[key.column]
+			}
+			result := compareCells(cellA, cellB)
+			if key.descending {
+				result = -result
+			}
+			if result != 0 {
+				return result
+			}
+		}
+		return 0
+	})
+}
+
+// distinctRows returns the rows without the duplicates of earlier rows.
+func distinctRows(rows [][]string) (result [][]string) {
+	seen := map[string]bool{}
+	for _, row := range rows {
+		// The unit separator does not appear in the cells of text tables
+		key := strings.Join(row, "\x1f")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, row)
+	}
+	return
+}
@@ -0,0 +1,252 @@
+package mdpp
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	//revive:disable-next-line:dot-imports
+	. "github.com/knaka/go-utils"
+)
+
+// cellRange is a rectangular range of cells such as "A1:D20". The coordinates are 0-based and inclusive.
+type cellRange struct {
+	firstColumn, firstRow int
+	lastColumn, lastRow   int
+}
+
+// parseCellRange parses a range of cells such as "A1:D20".
+func parseCellRange(text string) (*cellRange, error) {
+	first, last, found := strings.Cut(text, ":")
+	if !found {
+		return nil, fmt.Errorf("range requires FIRST:LAST, e.g. A1:D20: %s", text)
+	}
+	firstColumn, firstRow, err := excelize.CellNameToCoordinates(strings.ToUpper(first))
+	if err != nil {
+		return nil, err
+	}
+	lastColumn, lastRow, err := excelize.CellNameToCoordinates(strings.ToUpper(last))
+	if err != nil {
+		return nil, err
+	}
+	return &cellRange{
+		firstColumn: min(firstColumn, lastColumn) - 1,
+		firstRow:    min(firstRow, lastRow) - 1,
+		lastColumn:  max(firstColumn, lastColumn) - 1,
+		lastRow:     max(firstRow, lastRow) - 1,
+	}, nil
+}
+
+// extract returns the cells of the grid in the range. Cells outside the grid are empty.
+func (r *cellRange) extract(grid [][]string) (tableData [][]string) {
+	for rowIndex := r.firstRow; rowIndex <= r.lastRow; rowIndex++ {
+		row := make([]string, r.lastColumn-r.firstColumn+1)
+		if rowIndex < len(grid) {
+			for i := range row {
+				if columnIndex := r.firstColumn + i; columnIndex < len(grid[rowIndex]) {
+					row[i] = grid[rowIndex][columnIndex]
+				}
+			}
+		}
+		tableData = append(tableData, row)
+	}
+	return
+}
+
+// trimEmptyRows removes the empty rows at the end of the grid, which spreadsheets often have.
+func trimEmptyRows(grid [][]string) [][]string {
+	for len(grid) > 0 && !slices.ContainsFunc(grid[len(grid)-1], func(cell string) bool { return cell != "" }) {
+		grid = grid[:len(grid)-1]
+	}
+	return grid
+}
+
+// loadSpreadsheet loads the cells of a sheet of an .xlsx or .ods file. The first sheet is loaded if sheetName is empty, and the used cells of the sheet if cells is nil.
+func loadSpreadsheet(filePath string, format string, sheetName string, cells *cellRange) (tableData [][]string, err error) {
+	var grid [][]string
+	switch format {
+	case "xlsx":
+		grid, err = loadXLSXSheet(filePath, sheetName)
+	case "ods":
+		grid, err = loadODSSheet(filePath, sheetName)
+	default:
+		err = fmt.Errorf("unsupported spreadsheet format: %s", format)
+	}
+	if err != nil {
+		return
+	}
+	if cells != nil {
+		grid = cells.extract(grid)
+	}
+	return trimEmptyRows(grid), nil
+}
+
+// loadXLSXSheet loads the values of the cells of a sheet of an .xlsx file as they are displayed. The values of formulas are the ones that the spreadsheet application saved, or are calculated if the file has none.
+func loadXLSXSheet(filePath string, sheetName string) (grid [][]string, err error) {
+	file, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return
+	}
+	defer (func() { Ignore(file.Close()) })()
+	if sheetName == "" {
+		sheetName = file.GetSheetName(0)
+	} else if index, _ := file.GetSheetIndex(sheetName); index < 0 {
+		return nil, fmt.Errorf("sheet not found: %s", sheetName)
+	}
+	if grid, err = file.GetRows(sheetName); err != nil {
+		return
+	}
+	// Formulas that have no saved values are read as empty cells
+	for rowIndex, row := range grid {
+		for columnIndex, cell := range row {
+			if cell != "" {
+				continue
+			}
+			cellName := Value(excelize.CoordinatesToCellName(columnIndex+1, rowIndex+1))
+			formula, err := file.GetCellFormula(sheetName, cellName)
+			if err != nil {
+				return nil, err
+			}
+			if formula == "" {
+				continue
+			}
+			if row[columnIndex], err = file.CalcCellValue(sheetName, cellName); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return
+}
+
+// Namespaces of the OpenDocument elements
+const (
+	odsTableNamespace = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsTextNamespace  = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// odsAttr returns the value of the attribute of the start element, or defaultValue if it does not have the attribute.
+func odsAttr(element xml.StartElement, space, local, defaultValue string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return defaultValue
+}
+
+// odsRepeat returns the number of repetitions of a row or a cell.
+func odsRepeat(element xml.StartElement, local string) int {
+	n, err := strconv.Atoi(odsAttr(element, odsTableNamespace, local, "1"))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// loadODSSheet loads the text of the cells of a sheet of an .ods file, which is the values of the cells as they are displayed, including the values of formulas.
+func loadODSSheet(filePath string, sheetName string) (grid [][]string, err error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return
+	}
+	defer (func() { Ignore(archive.Close()) })()
+	content, err := archive.Open("content.xml")
+	if err != nil {
+		return
+	}
+	defer (func() { Ignore(content.Close()) })()
+	grid, found, err := parseODSContent(content, sheetName)
+	if err == nil && !found {
+		err = fmt.Errorf("sheet not found: %s", sheetName)
+	}
+	return
+}
+
+// parseODSContent parses the content.xml of an .ods file and returns the cells of the sheet, or of the first sheet if sheetName is empty. The repeated empty rows and cells at the ends of the sheet are not expanded.
+func parseODSContent(reader io.Reader, sheetName string) (grid [][]string, found bool, err error) {
+	decoder := xml.NewDecoder(reader)
+	inTable := false
+	var row []string
+	rowRepeat := 0
+	pendingRows := 0  // The empty rows that are added only if a non-empty row follows
+	pendingCells := 0 // The empty cells that are added only if a non-empty cell follows
+	var cellText *strings.Builder
+	cellRepeat := 0
+	paragraphs := 0
+	for {
+		token, tokenErr := decoder.Token()
+		if tokenErr == io.EOF {
+			break
+		}
+		if tokenErr != nil {
+			return nil, false, tokenErr
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch {
+			case token.Name.Space == odsTableNamespace && token.Name.Local == "table":
+				if !found && (sheetName == "" || odsAttr(token, odsTableNamespace, "name", "") == sheetName) {
+					inTable, found = true, true
+				}
+			case !inTable:
+			case token.Name.Space == odsTableNamespace && token.Name.Local == "table-row":
+				row, rowRepeat, pendingCells = nil, odsRepeat(token, "number-rows-repeated"), 0
+			case token.Name.Space == odsTableNamespace && (token.Name.Local == "table-cell" || token.Name.Local == "covered-table-cell"):
+				cellText, cellRepeat, paragraphs = &strings.Builder{}, odsRepeat(token, "number-columns-repeated"), 0
+			case cellText == nil:
+			case token.Name.Space == odsTextNamespace && token.Name.Local == "p":
+				if paragraphs > 0 {
+					cellText.WriteString("\n")
+				}
+				paragraphs++
+			case token.Name.Space == odsTextNamespace && token.Name.Local == "s":
+				n, _ := strconv.Atoi(odsAttr(token, odsTextNamespace, "c", "1"))
+				cellText.WriteString(strings.Repeat(" ", max(n, 1)))
+			case token.Name.Space == odsTextNamespace && token.Name.Local == "tab":
+				cellText.WriteString("\t")
+			case token.Name.Space == odsTextNamespace && token.Name.Local == "line-break":
+				cellText.WriteString("\n")
+			}
+		case xml.CharData:
+			if inTable && cellText != nil && paragraphs > 0 {
+				cellText.Write(token)
+			}
+		case xml.EndElement:
+			switch {
+			case !inTable:
+			case token.Name.Space == odsTableNamespace && token.Name.Local == "table":
+				return
+			case token.Name.Space == odsTableNamespace && (token.Name.Local == "table-cell" || token.Name.Local == "covered-table-cell"):
+				if text := cellText.String(); text == "" {
+					pendingCells += cellRepeat
+				} else {
+					row = append(row, make([]string, pendingCells)...)
+					pendingCells = 0
+					for range cellRepeat {
+						row = append(row, text)
+					}
+				}
+				cellText = nil
+			case token.Name.Space == odsTableNamespace && token.Name.Local == "table-row":
+				if len(row) == 0 {
+					pendingRows += rowRepeat
+					continue
+				}
+				for range pendingRows {
+					grid = append(grid, nil)
+				}
+				pendingRows = 0
+				for range rowRepeat {
+					grid = append(grid, slices.Clone(row))
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,9 @@
+func newClient() *Client {
+	// mdpp:hide
+	setupTracing()
+	// mdpp:show
+	return &Client{
+		URL: "https://api-7.corp.example.com/v1", // Internal endpoint
+		Key: os.Getenv("API_TOKEN"),
+	}
+}
@@ -0,0 +1,53 @@
+// Package greet builds greeting messages.
+package greet
+
+import "strings"
+
+// DefaultName is the name used when no name is given.
+const DefaultName = "world"
+
+// Pattern matches the greetings.
+const Pattern = `^(Hello|HELLO), .+[.!]$`
+
+// Decorate decorates the greeting.
+var Decorate = func(greeting string) string {
+	return "*" + greeting + "*"
+}
+
+// Styles of greetings.
+const (
+	// Plain greets without decoration.
+	Plain Style = iota
+	Shout
+)
+
+// Style is a style of greetings.
+type Style int
+
+// Greeter builds greeting messages. It is safe for concurrent use.
+type Greeter struct {
+	style Style
+}
+
+// NewGreeter returns a greeter with the style.
+func NewGreeter(style Style) *Greeter {
+	return &Greeter{style: style}
+}
+
+// Greet returns the greeting for the name.
+func (g *Greeter) Greet(name string) string {
+	if name == "" {
+		name = DefaultName
+	}
+	if g.style == Shout {
+		return "HELLO, " + strings.ToUpper(name) + "!"
+	}
+	return "Hello, " + name + "."
+}
+
+// Join joins the names with "|" or the separator.
+func Join(names []string, sep string) string {
+	return strings.Join(names, sep)
+}
+
+func unexported() {}
@@ -0,0 +1,27 @@
+package greet_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func ExampleGreet() {
+	// Greet in upper case
+	name := "world"
+	fmt.Println("Hello, " + strings.ToUpper(name) + "!")
+	// Output:
+	// Hello, WORLD!
+}
+
+func ExampleGreet_noOutput() {
+	fmt.Println("Hi")
+}
+
+func ExampleGreet_sorted() {
+	names := []string{"b", "a"}
+	// Sort so that the output: is stable
+	sort.Strings(names)
+	fmt.Println(names)
+	// Output: [a b]
+}
@@ -0,0 +1,16 @@
+package greet_test
+
+import "fmt"
+
+type greeter struct {
+	name string
+}
+
+func (g greeter) greet() string {
+	return "Hello, " + g.name
+}
+
+func ExampleGreeter() {
+	fmt.Println(greeter{"gopher"}.greet())
+	// Output: Hello, gopher
+}
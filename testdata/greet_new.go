@@ -0,0 +1,11 @@
+package greet
+
+import "fmt"
+
+func Greet(name string) string {
+	return fmt.Sprintf("Hello, %s!", name)
+}
+
+func Bye() string {
+	return "Bye"
+}
@@ -0,0 +1,9 @@
+package greet
+
+func Greet(name string) string {
+	return "Hello, " + name
+}
+
+func Bye() string {
+	return "Bye"
+}
@@ -0,0 +1,8 @@
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name") // hl
+	if name == "" {
+		name = "world" // hl
+	}
+	fmt.Fprintf(w, "Hello, %s!", name)
+}
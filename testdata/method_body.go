@@ -0,0 +1,8 @@
+
+	func (g *Greeter) Greet(name string) string {
+		if name == "" {
+			name = "world"
+		}
+		return "Hello, " + name
+	}
+
@@ -0,0 +1,5 @@
+func hidden() {
+	// Lines between mdpp:hide and mdpp:show markers are hidden
+	// mdpp:hide
+	setupTracing()
+}
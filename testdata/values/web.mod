@@ -0,0 +1,8 @@
+module example.com/web
+
+go 1.24.0
+
+require (
+	github.com/yuin/goldmark v1.7.8
+	gopkg.in/yaml.v3 v3.0.1
+)
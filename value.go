@@ -0,0 +1,274 @@
+package mdpp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/mod/modfile"
+	"gopkg.in/yaml.v3"
+
+	gmast "github.com/yuin/goldmark/ast"
+	gmtext "github.com/yuin/goldmark/text"
+
+	//revive:disable-next-line:dot-imports
+	. "github.com/knaka/go-utils"
+)
+
+// loadStructuredFile loads a JSON, YAML, TOML or go.mod file as a tree of maps, slices and scalars. The format is determined by the file extension.
+func loadStructuredFile(filePath string) (data any, err error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+	switch ext := strings.ToLower(filepath.Ext(filePath)); ext {
+	case ".mod":
+		// go.mod, or an alternative go.mod file used with the -modfile flag
+		return loadGoMod(filePath, content)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		// Keep numbers as written, e.g. "1.0" rather than "1"
+		decoder.UseNumber()
+		err = decoder.Decode(&data)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &data)
+	case ".toml":
+		_, err = toml.Decode(string(content), &data)
+	default:
+		err = fmt.Errorf("unsupported file type: %s", filePath)
+	}
+	return
+}
+
+// loadGoMod loads a go.mod file as a map with the keys "module", "go", "toolchain" and "require", which maps module paths to versions.
+func loadGoMod(filePath string, content []byte) (any, error) {
+	file, err := modfile.ParseLax(filePath, content, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]any{}
+	if file.Module != nil {
+		data["module"] = file.Module.Mod.Path
+	}
+	if file.Go != nil {
+		data["go"] = file.Go.Version
+	}
+	if file.Toolchain != nil {
+		data["toolchain"] = file.Toolchain.Name
+	}
+	require := map[string]any{}
+	for _, req := range file.Require {
+		require[req.Mod.Path] = req.Mod.Version
+	}
+	data["require"] = require
+	return data, nil
+}
+
+// parseValuePath parses a path expression such as `.version`, `.dependencies["@types/node"]` or `.items[0].name` into keys and indexes.
+func parseValuePath(expr string) (steps []any, err error) {
+	rest := expr
+	for rest != "" {
+		switch {
+		case rest == ".":
+			rest = ""
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path: %s", expr)
+			}
+			steps = append(steps, rest[1:end+1])
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if strings.HasPrefix(rest, `["`) {
+				// A quoted key can contain "]"
+				end = strings.Index(rest, `"]`) + 1
+			}
+			if end <= 1 {
+				return nil, fmt.Errorf("invalid path: %s", expr)
+			}
+			inner := rest[1:end]
+			if key, err := strconv.Unquote(inner); err == nil {
+				steps = append(steps, key)
+			} else if index, err := strconv.Atoi(inner); err == nil {
+				steps = append(steps, index)
+			} else {
+				// The quotes may have been removed as the directive arguments are split
+				steps = append(steps, inner)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path: %s", expr)
+		}
+	}
+	return
+}
+
+// selectValue returns the value at the path in the data.
+func selectValue(data any, expr string) (any, error) {
+	steps, err := parseValuePath(expr)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		switch step := step.(type) {
+		case string:
+			object, ok := data.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("not an object at %q in %s", step, expr)
+			}
+			if data, ok = object[step]; !ok {
+				return nil, fmt.Errorf("key %q not found in %s", step, expr)
+			}
+		case int:
+			array, ok := data.([]any)
+			if tables, isTables := data.([]map[string]any); isTables {
+				// TOML decodes an array of tables into a slice of maps
+				array, ok = make([]any, len(tables)), true
+				for i, table := range tables {
+					array[i] = table
+				}
+			}
+			if !ok {
+				return nil, fmt.Errorf("not an array at [%d] in %s", step, expr)
+			}
+			if step < 0 || step >= len(array) {
+				return nil, fmt.Errorf("index [%d] out of range in %s", step, expr)
+			}
+			data = array[step]
+		}
+	}
+	return data, nil
+}
+
+// formatValue formats a scalar as it is, and an object or an array as compact JSON.
+func formatValue(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return value, nil
+	case map[string]any, []any, []map[string]any:
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// findCodeSpanStart finds the start of the code span that ends at endPos by scanning backward for the opening backtick run of the same length as the closing one. Returns -1 if there is no code span.
+func findCodeSpanStart(sourceMD []byte, endPos int) int {
+	runStart := endPos
+	for runStart > 0 && sourceMD[runStart-1] == '`' {
+		runStart--
+	}
+	runLength := endPos - runStart
+	if runLength == 0 {
+		return -1
+	}
+	for pos := runStart - 1; pos >= runLength-1; pos-- {
+		if sourceMD[pos] != '`' {
+			continue
+		}
+		// pos is the last backtick of a run
+		start := pos
+		for start > 0 && sourceMD[start-1] == '`' {
+			start--
+		}
+		if pos-start+1 == runLength {
+			return start
+		}
+		pos = start
+	}
+	return -1
+}
+
+// formatCodeSpan returns a code span that contains the text, with backtick runs longer than any in the text. Line breaks are written as spaces, as a code span shows them, except trailing ones, which are dropped, and an empty text is written as a space, since a code span cannot be empty.
+func formatCodeSpan(text string) string {
+	text = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(strings.TrimRight(text, "\r\n"))
+	if text == "" {
+		text = " "
+	}
+	longest := 0
+	for run := 0; ; {
+		i := strings.IndexByte(text[run:], '`')
+		if i < 0 {
+			break
+		}
+		n := len(text[run+i:]) - len(strings.TrimLeft(text[run+i:], "`"))
+		longest = max(longest, n)
+		run += i + n
+	}
+	fence := strings.Repeat("`", longest+1)
+	// A code span strips a space on both sides of its content unless the content is all spaces
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") ||
+		strings.HasPrefix(text, " ") && strings.HasSuffix(text, " ") && strings.TrimLeft(text, " ") != "" {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+// processValueDirective processes a VALUE directive, which replaces the code span before the directive with a value selected from a structured file, writes the result to writer, and returns the new writing position.
+func processValueDirective(
+	sourceMD []byte, // The source markdown content
+	writer io.Writer, // The output destination
+	writePos int, // The current write position in the source
+	directiveNode gmast.Node, // The AST node containing the directive
+	directiveSegments *gmtext.Segments, // The text segments of the directive
+	argsText string, // The arguments of the directive
+	params *processParams, // The processing parameters
+) (
+	nextWritePos int, // The next write position after processing.
+) {
+	nextWritePos = writePos
+	if directiveSegments == nil || directiveSegments.Len() != 1 {
+		return
+	}
+	prevNode := directiveNode.PreviousSibling()
+	if prevNode == nil || prevNode.Kind() != gmast.KindCodeSpan {
+		return
+	}
+	args, err := parseDirectiveArgs(argsText)
+	if err != nil {
+		params.warnf("%v", err)
+		return
+	}
+	if len(args.positional) < 2 {
+		params.warnf("VALUE requires a file and a path: %s", argsText)
+		return
+	}
+	filePath, expr := args.positional[0], args.positional[1]
+	data, err := loadStructuredFile(filePath)
+	if err != nil {
+		params.warnf("VALUE %s: %v", filePath, err)
+		return
+	}
+	value, err := selectValue(data, expr)
+	var text string
+	if err == nil {
+		text, err = formatValue(value)
+	}
+	if err != nil {
+		params.warnf("VALUE %s: %v", filePath, err)
+		return
+	}
+	directiveStartPos := directiveSegments.At(0).Start
+	codeSpanStartPos := findCodeSpanStart(sourceMD, directiveStartPos)
+	if codeSpanStartPos < 0 {
+		return
+	}
+	Must(writer.Write(sourceMD[writePos:codeSpanStartPos]))
+	Must(io.WriteString(writer, formatCodeSpan(text)))
+	nextWritePos = directiveSegments.At(directiveSegments.Len() - 1).Stop
+	Must(writer.Write(sourceMD[directiveStartPos:nextWritePos]))
+	return
+}